@@ -0,0 +1,201 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// maxStatementSize is the size in bytes above which a batch insert is split
+// into multiple statements, safely below the statement size limit of
+// Databricks SQL warehouses.
+const maxStatementSize = 8 << 20
+
+// InsertBatch inserts the records with a single multi-row INSERT statement,
+// unless the statement gets too big, in which case it's split up. If the
+// batch fails after some of the statements have been executed, a BatchError
+// reports the number of records which have been inserted. In exactly-once
+// mode, the records are inserted one by one, since the position of every
+// record needs to be checked.
+func (c *sqlClient) InsertBatch(ctx context.Context, records []opencdc.Record) error {
+	t, err := c.forTable(ctx)
+	if err != nil {
+		return err
+	}
+	if t != c {
+		return t.InsertBatch(ctx, records)
+	}
+
+	c.refreshColumnsIfDue(ctx)
+	if len(records) > 0 {
+		if err := c.createTableFor(ctx, records[0]); err != nil {
+			return err
+		}
+	}
+	if err := c.addMissingColumns(ctx, records...); err != nil {
+		return err
+	}
+	if c.config.ExactlyOnce {
+		for i, r := range records {
+			if err := c.Insert(ctx, r); err != nil {
+				if i > 0 {
+					return &BatchError{Written: i, Err: err}
+				}
+				return err
+			}
+		}
+		return nil
+	}
+
+	// statements of the batch which have been executed aren't executed
+	// again when the insert is retried, only the records after them are
+	ctx = withNonIdempotentWrite(ctx)
+	inserted := 0
+	insertRest := func(ctx context.Context) error {
+		return c.retryOnError(ctx, func(ctx context.Context) error {
+			return c.reconnectOnError(ctx, func(ctx context.Context) error {
+				n, err := c.insertBatch(ctx, records[inserted:])
+				inserted += n
+				return err
+			})
+		})
+	}
+	// like single records, the batch is retried once with explicit
+	// casts, if it fails because of an implicit cast
+	insertBatch := func(ctx context.Context) error {
+		err := insertRest(ctx)
+		if err == nil || !c.config.AnsiCastRetry || !isCastError(err) {
+			return err
+		}
+
+		sdk.Logger(ctx).Debug().Err(err).Msg("batch insert failed because of an implicit cast, retrying with explicit casts")
+		return insertRest(withExplicitCasts(ctx))
+	}
+	err = insertBatch(ctx)
+	if err != nil && c.config.SchemaRefreshOnError && isSchemaError(err) {
+		sdk.Logger(ctx).Debug().Err(err).Msg("batch insert failed because of a schema change, refreshing column information")
+		if refreshErr := c.refreshColumns(ctx); refreshErr != nil {
+			err = fmt.Errorf("unable to refresh column information: %w (write error: %w)", refreshErr, err)
+		} else {
+			err = insertBatch(ctx)
+		}
+	}
+	if err != nil && inserted > 0 {
+		return &BatchError{Written: inserted, Err: err}
+	}
+
+	return err
+}
+
+// insertBatch inserts the records and returns the number of records which
+// have been inserted, which are at the start of records. The statements are
+// built before any of them is executed, so that an invalid statement doesn't
+// leave the batch partially inserted.
+func (c *sqlClient) insertBatch(ctx context.Context, records []opencdc.Record) (int, error) {
+	sdk.Logger(ctx).Trace().Msgf("inserting %v records", len(records))
+
+	values := make([]map[string]interface{}, len(records))
+	for i, r := range records {
+		v, err := c.insertValues(ctx, r)
+		if err != nil {
+			return 0, fmt.Errorf("failed getting values of record %v: %w", i, err)
+		}
+		values[i] = c.castToColumnType(ctx, v)
+	}
+
+	statements, err := c.batchStatements(values)
+	if err != nil {
+		return 0, err
+	}
+
+	inserted := 0
+	for _, stmt := range statements {
+		sdk.Logger(ctx).Trace().Msgf("insert sql string\n%v\n", c.loggedSQL(stmt.sql))
+
+		res, err := c.execContext(ctx, stmt.sql)
+		if err != nil {
+			return inserted, fmt.Errorf("failed to execute db statement: %w", classifyError(err))
+		}
+		if err := c.checkInserted(res, int64(stmt.rows)); err != nil {
+			return inserted, err
+		}
+		inserted += stmt.rows
+	}
+
+	return inserted, nil
+}
+
+// batchStatement is a statement inserting the given number of rows.
+type batchStatement struct {
+	sql  string
+	rows int
+}
+
+// batchStatements builds the statements which insert rows, a single one,
+// or the statements of two halves of them if it would be too big. Columns
+// missing in a row are set to NULL.
+func (c *sqlClient) batchStatements(values []map[string]interface{}) ([]batchStatement, error) {
+	columns := batchColumns(values)
+	rows := make([][]interface{}, len(values))
+	for i, v := range values {
+		row := make([]interface{}, len(columns))
+		for j, col := range columns {
+			row[j] = v[col]
+		}
+		rows[i] = row
+	}
+
+	sqlString, err := c.queryBuilder.buildInsertBatch(c.tableName, columns, rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed building query: %w", err)
+	}
+	if len(sqlString) > maxStatementSize && len(values) > 1 {
+		half := len(values) / 2
+		first, err := c.batchStatements(values[:half])
+		if err != nil {
+			return nil, err
+		}
+		second, err := c.batchStatements(values[half:])
+		if err != nil {
+			return nil, err
+		}
+		return append(first, second...), nil
+	}
+
+	return []batchStatement{{sql: sqlString, rows: len(rows)}}, nil
+}
+
+// batchColumns returns the columns of all rows, sorted by name,
+// so that the values of all rows line up.
+func batchColumns(values []map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, v := range values {
+		for col := range v {
+			if !seen[col] {
+				seen[col] = true
+				columns = append(columns, col)
+			}
+		}
+	}
+	sort.Strings(columns)
+
+	return columns
+}
@@ -0,0 +1,69 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+)
+
+const (
+	binaryEncodingBase64 = "base64"
+	binaryEncodingHex    = "hex"
+)
+
+// binaryParameter is the base64 encoded value of a BINARY column, passed
+// as a statement parameter. The driver has no parameter type for binary
+// values, so it's decoded with unbase64 in the statement.
+type binaryParameter string
+
+func isBinaryType(dataType string) bool {
+	return strings.EqualFold(strings.TrimSpace(dataType), "BINARY")
+}
+
+// binaryValue returns the bytes of v, which is written to a BINARY column.
+// Strings are decoded as configured by binaryInputEncoding, byte slices are
+// taken as they are. It returns false if v is neither, e.g. if it's nil.
+func (c *sqlClient) binaryValue(col string, v interface{}) ([]byte, bool, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, true, nil
+	case string:
+		if c.config.BinaryInputEncoding == binaryEncodingHex {
+			b, err := hex.DecodeString(v)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed decoding hex value for BINARY column %q: %w", col, err)
+			}
+			return b, true, nil
+		}
+		b, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed decoding base64 value for BINARY column %q: %w", col, err)
+		}
+		return b, true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+// binaryLiteral renders b as a Databricks hex literal, e.g. X'1f8b'.
+func binaryLiteral(b []byte) exp.LiteralExpression {
+	return goqu.L("X'" + hex.EncodeToString(b) + "'")
+}
@@ -0,0 +1,91 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"strings"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/doug-martin/goqu/v9"
+)
+
+type explicitCastsKey struct{}
+
+// withExplicitCasts returns a context which makes writes cast
+// every value to the type of its column explicitly.
+func withExplicitCasts(ctx context.Context) context.Context {
+	return context.WithValue(ctx, explicitCastsKey{}, true)
+}
+
+func explicitCasts(ctx context.Context) bool {
+	v, _ := ctx.Value(explicitCastsKey{}).(bool)
+	return v
+}
+
+// withCastRetry returns a writeFunc which, if ansiCastRetry is enabled,
+// retries the write once with explicit casts, when the write fails because
+// a value can't be cast implicitly to the column type in ANSI mode.
+func (c *sqlClient) withCastRetry(write writeFunc) writeFunc {
+	return func(ctx context.Context, record opencdc.Record) error {
+		err := write(ctx, record)
+		if err == nil || !c.config.AnsiCastRetry || !isCastError(err) {
+			return err
+		}
+
+		sdk.Logger(ctx).Debug().Err(err).Msg("write failed because of an implicit cast, retrying with explicit casts")
+		return write(withExplicitCasts(ctx), record)
+	}
+}
+
+// castToColumnType wraps values in a CAST to the type of their column,
+// if requested by ctx. Values of unknown columns and NULLs are left as
+// they are.
+func (c *sqlClient) castToColumnType(ctx context.Context, values map[string]interface{}) map[string]interface{} {
+	if !explicitCasts(ctx) {
+		return values
+	}
+
+	cast := make(map[string]interface{}, len(values))
+	for col, v := range values {
+		dataType := c.columnType(col)
+		if dataType == "" || v == nil {
+			cast[col] = v
+			continue
+		}
+		cast[col] = goqu.L("CAST(? AS "+strings.ToUpper(dataType)+")", v)
+	}
+
+	return cast
+}
+
+// castTypes returns the types to which the values of parameterized
+// statements are cast, if requested by ctx, by column. Unknown columns
+// and NULLs aren't cast.
+func (c *sqlClient) castTypes(ctx context.Context, values map[string]interface{}) map[string]string {
+	if !explicitCasts(ctx) {
+		return nil
+	}
+
+	types := make(map[string]string, len(values))
+	for col, v := range values {
+		if dataType := c.columnType(col); dataType != "" && v != nil {
+			types[col] = strings.ToUpper(dataType)
+		}
+	}
+
+	return types
+}
@@ -17,13 +17,20 @@ package databricks
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/conduitio/conduit-commons/opencdc"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	dbsql "github.com/databricks/databricks-sql-go"
+	"github.com/databricks/databricks-sql-go/auth/oauth/m2m"
 	"github.com/rs/zerolog"
 )
 
@@ -35,117 +42,567 @@ func init() {
 
 const ansiMode = "ansi_mode"
 
+// userAgentEntryParam is the DSN parameter setting the user agent entry.
+const userAgentEntryParam = "userAgentEntry"
+
+// Modes of checking the number of rows affected by an insert, other
+// than the default which requires exactly one row.
+const (
+	insertAffectedAtLeastOne = "atLeastOne"
+	insertAffectedNone       = "none"
+)
+
 type queryBuilder interface {
 	buildInsert(table string, values map[string]interface{}) (string, error)
-	buildUpdate(table string, keys map[string]interface{}, values map[string]interface{}) (string, error)
-	buildDelete(table string, keys map[string]interface{}) (string, error)
+	buildInsertBatch(table string, columns []string, rows [][]interface{}) (string, error)
+	buildInsertParameterized(table string, values map[string]interface{}, casts map[string]string) (string, []interface{}, error)
+	buildUpdate(table string, key recordKey, values map[string]interface{}) (string, error)
+	buildDelete(table string, key recordKey) (string, error)
+	buildSoftDelete(table string, key recordKey, column string, value string) (string, error)
+	buildUpsert(table string, keys map[string]interface{}, values map[string]interface{}) (string, error)
+
+	buildPositionLookup(positionsTable string, tableColumn string, positionColumn string, table string, position string) (string, error)
+	buildReadBack(table string, columns []string, key recordKey) (string, error)
+	buildSelect(table string, orderingColumn string, lastValue interface{}, upperBound interface{}, limit int) (string, error)
+	buildMaxValue(table string, column string) (string, error)
+	buildSoftDeleted(table string, softDeleteColumn string, watermarkColumn string, orderingColumn string, lastValue interface{}, watermark interface{}, watermarkLastValue interface{}, limit int) (string, error)
+	buildTableChanges(table string, orderingColumn string, version int64) (string, error)
+	buildCopyInto(table string, dir string, file string, format string) (string, error)
 
 	describeTable(table string) string
+	describeHistory(table string) string
+	showChangeDataFeed(table string) string
+	showViews(name string) string
+	createTable(table string, columns []string, types map[string]string) string
+	addColumns(table string, columns []string, types map[string]string) string
+
+	putFile(local string, staged string) string
+	removeFile(staged string) string
 }
 
 type sqlClient struct {
-	db           *sql.DB
-	tableName    string
-	columns      []string
+	db        *sql.DB
+	config    Config
+	tableName string
+	// columnsMu guards the column information, which can be refreshed
+	// while the connector runs
+	columnsMu   sync.RWMutex
+	columns     []string
+	columnTypes map[string]string
+	// columnsByLower maps the lowercased column names to the names
+	// as they are in the table, since Databricks column names are
+	// case-insensitive
+	columnsByLower map[string]string
+	// columnComments is only populated if captureColumnComments is enabled
+	columnComments map[string]string
+	// encryptors transform the values of sensitive columns, by column name
+	encryptors   map[string]Encryptor
 	queryBuilder queryBuilder
+	// openDB opens the database, it's replaced in tests
+	openDB func(Config) (*sql.DB, error)
+	// reconnects counts the times the connection has been rebuilt
+	reconnects int
+	// schemaMu serializes changes of the table schema
+	schemaMu sync.Mutex
+	// refreshDue is set when the column information is due for the
+	// periodic refresh, which is done with the next write
+	refreshDue atomic.Bool
+	// stopSchemaRefresh stops the periodic refresh, if it's running
+	stopSchemaRefresh func()
+	// tableMissing is true until the table, which didn't exist when opening,
+	// has been created, if createTableIfNotExists is enabled
+	tableMissing bool
+	// tables are the clients writing to the tables which
+	// records are routed to, by qualified table name
+	tablesMu sync.Mutex
+	tables   map[string]*sqlClient
 }
 
 func newClient() *sqlClient {
 	return &sqlClient{
 		queryBuilder: &ansiQueryBuilder{},
+		openDB:       openDB,
 	}
 }
 
 func (c *sqlClient) Open(ctx context.Context, config Config) error {
 	sdk.Logger(ctx).Debug().Msg("opening sql client")
 
-	connector, err := dbsql.NewConnector(
-		dbsql.WithAccessToken(config.Token),
-		dbsql.WithServerHostname(config.Host),
-		dbsql.WithPort(config.Port),
-		dbsql.WithHTTPPath(config.HTTPath),
-		dbsql.WithSessionParams(map[string]string{
-			ansiMode: "true",
-		}),
-	)
+	db, err := c.connect(config)
 	if err != nil {
-		return fmt.Errorf("invalid configuration: %w", err)
+		return err
 	}
 
-	db := sql.OpenDB(connector)
+	c.db = db
+	c.config = config
 
 	sdk.Logger(ctx).Debug().Msg("pinging database")
-	if err = db.PingContext(ctx); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+	if err = c.reconnectOnError(ctx, c.ping); err != nil {
+		return err
 	}
-	c.db = db
-	c.tableName = config.TableName
+	c.tableName = config.qualifiedTableName()
+	c.queryBuilder = &ansiQueryBuilder{identifierQuoting: config.IdentifierQuoting}
 
-	err = c.getColumnInfo()
-	if err != nil {
+	if err := c.openEncryptors(); err != nil {
+		return err
+	}
+
+	if config.ValidateTableOnOpen != validateTableNone {
+		if err := c.validateTable(ctx); err != nil {
+			return err
+		}
+	}
+
+	// the column information is read again after a reconnect,
+	// so it's never left over from a broken connection
+	err = c.reconnectOnError(ctx, c.getColumnInfoWithRetry)
+	switch {
+	case err != nil && config.CreateTableIfNotExists && isTableNotFound(err):
+		sdk.Logger(ctx).Info().Msgf("table %v not found, creating it with the first record", c.tableName)
+		c.tableMissing = true
+	case err != nil:
 		return fmt.Errorf("unable to get column information: %w", err)
+	default:
+		if err := c.checkConfiguredColumns(); err != nil {
+			return err
+		}
 	}
 
+	if config.ExactlyOnce {
+		if err := c.openPositionsTable(ctx); err != nil {
+			return err
+		}
+	}
+
+	c.startSchemaRefresh()
+
 	sdk.Logger(ctx).Debug().Msg("sql client opened")
 	return nil
 }
 
+// checkConfiguredColumns checks that the columns referenced
+// in the configuration exist in the table.
+func (c *sqlClient) checkConfiguredColumns() error {
+	for _, col := range c.config.ReadBackColumns {
+		if !c.hasColumn(col) {
+			return fmt.Errorf("read back column %q not found in table %v", col, c.tableName)
+		}
+	}
+	for _, col := range c.config.KeyColumns {
+		if !c.hasColumn(col) {
+			return fmt.Errorf("key column %q not found in table %v", col, c.tableName)
+		}
+	}
+
+	if err := c.checkMappedColumns(); err != nil {
+		return err
+	}
+
+	return c.checkSoftDeleteColumn()
+}
+
+// openDB opens the database using the DSN, if one is configured,
+// or the individual connection parameters otherwise.
+func openDB(config Config) (*sql.DB, error) {
+	if config.DSN != "" {
+		params := config.sessionParams()
+		params[userAgentEntryParam] = config.userAgentEntry()
+		dsn, err := withDSNParams(config.DSN, params)
+		if err != nil {
+			return nil, err
+		}
+		db, err := sql.Open("databricks", dsn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dsn: %w", err)
+		}
+		return db, nil
+	}
+
+	opts := []dbsql.ConnOption{
+		dbsql.WithServerHostname(config.Host),
+		dbsql.WithPort(config.Port),
+		dbsql.WithHTTPPath(config.HTTPath),
+		dbsql.WithSessionParams(config.sessionParams()),
+		dbsql.WithUserAgentEntry(config.userAgentEntry()),
+	}
+	if config.ClientID != "" {
+		opts = append(opts, dbsql.WithAuthenticator(m2m.NewAuthenticator(config.ClientID, config.ClientSecret, config.Host)))
+	} else {
+		opts = append(opts, dbsql.WithAccessToken(config.Token))
+	}
+	if config.ProxyURL != "" {
+		opts = append(opts, dbsql.WithTransport(config.proxyTransport()))
+	}
+	if !config.AllowWarehouseAutostart {
+		// the driver retries while a stopped warehouse is starting,
+		// which is exactly what needs to be avoided
+		opts = append(opts, dbsql.WithRetries(-1, 0, 0))
+	}
+
+	connector, err := dbsql.NewConnector(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return sql.OpenDB(connector), nil
+}
+
+// sessionParams returns the configured session parameters, along with the
+// ones the connector relies on, unless they're configured differently.
+func (c Config) sessionParams() map[string]string {
+	params := map[string]string{ansiMode: "true"}
+	for k, v := range c.SessionParams {
+		if strings.EqualFold(k, ansiMode) {
+			delete(params, ansiMode)
+		}
+		params[k] = v
+	}
+
+	return params
+}
+
+// userAgentEntry returns the entry the connector adds to the user agent.
+func (c Config) userAgentEntry() string {
+	if c.ApplicationName != "" {
+		return c.ApplicationName
+	}
+
+	return "conduit-databricks-connector/" + version
+}
+
+// withDSNParams adds the parameters, e.g. session parameters,
+// to the DSN, unless the DSN already sets them.
+func withDSNParams(dsn string, params map[string]string) (string, error) {
+	full := dsn
+	if !strings.HasPrefix(dsn, "https://") && !strings.HasPrefix(dsn, "http://") {
+		full = "https://" + dsn
+	}
+	u, err := url.Parse(full)
+	if err != nil {
+		return "", fmt.Errorf("invalid dsn: %w", err)
+	}
+
+	q := u.Query()
+	added := false
+	for k, v := range params {
+		if !q.Has(k) {
+			q.Set(k, v)
+			added = true
+		}
+	}
+	if !added {
+		return dsn, nil
+	}
+	u.RawQuery = q.Encode()
+
+	return strings.TrimPrefix(u.String(), "https://"), nil
+}
+
 func (c *sqlClient) Close() error {
+	if c.stopSchemaRefresh != nil {
+		c.stopSchemaRefresh()
+	}
+
+	var errs []error
+	c.tablesMu.Lock()
+	for _, t := range c.tables {
+		errs = append(errs, t.Close())
+	}
+	c.tablesMu.Unlock()
 	if c.db != nil {
-		return c.db.Close()
+		errs = append(errs, c.db.Close())
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 func (c *sqlClient) Insert(ctx context.Context, record opencdc.Record) error {
-	sdk.Logger(ctx).Trace().Msg("inserting record")
+	t, err := c.forTable(ctx)
+	if err != nil {
+		return err
+	}
+	if t != c {
+		return t.Insert(ctx, record)
+	}
+	// the position is only checked before the first attempt, so exactly-once
+	// inserts could be written twice when they're retried as well
+	ctx = withNonIdempotentWrite(ctx)
 
-	payload := make(opencdc.StructuredData)
-	if err := json.Unmarshal(record.Payload.After.Bytes(), &payload); err != nil {
-		return fmt.Errorf("error unmarshalling payload: %w", err)
+	return c.writeOnce(ctx, record, c.withRetry(c.withReconnect(c.withSchemaRefresh(c.withCastRetry(c.withAutoAddColumns(c.insert))))))
+}
+
+func (c *sqlClient) Upsert(ctx context.Context, record opencdc.Record) error {
+	t, err := c.forTable(ctx)
+	if err != nil {
+		return err
+	}
+	if t != c {
+		return t.Upsert(ctx, record)
 	}
 
-	key := make(opencdc.StructuredData)
-	if err := json.Unmarshal(record.Key.Bytes(), &key); err != nil {
-		return fmt.Errorf("error unmarshalling key: %w", err)
+	return c.writeOnce(ctx, record, c.withRetry(c.withReconnect(c.withSchemaRefresh(c.withCastRetry(c.withAutoAddColumns(c.upsert))))))
+}
+
+// ReadBack reads the values of the configured read-back columns
+// of the row inserted for record, which is looked up by its key.
+func (c *sqlClient) ReadBack(ctx context.Context, record opencdc.Record) (opencdc.StructuredData, error) {
+	t, err := c.forTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if t != c {
+		return t.ReadBack(ctx, record)
+	}
+
+	key, err := c.resolveKey(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	if len(key.columns) == 0 {
+		return nil, errors.New("record has no key to read back the inserted row with")
+	}
+
+	sqlString, err := c.queryBuilder.buildReadBack(c.tableName, c.config.ReadBackColumns, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed building read back query: %w", err)
+	}
+	sdk.Logger(ctx).Trace().Msgf("read back sql string\n%v\n", c.loggedSQL(sqlString))
+
+	values := make([]interface{}, len(c.config.ReadBackColumns))
+	pointers := make([]interface{}, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	queryCtx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	err = c.db.QueryRowContext(queryCtx, sqlString).Scan(pointers...)
+	c.logIfSlow(ctx, sqlString, start)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("inserted row not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed read back: %w", classifyError(timeoutError(ctx, queryCtx, err)))
 	}
 
-	insertValues := c.merge(payload, key)
+	readBack := make(opencdc.StructuredData, len(values))
+	for i, col := range c.config.ReadBackColumns {
+		if b, ok := values[i].([]byte); ok {
+			values[i] = string(b)
+		}
+		readBack[col] = values[i]
+	}
+
+	return readBack, nil
+}
+
+func (c *sqlClient) Update(ctx context.Context, record opencdc.Record) error {
+	t, err := c.forTable(ctx)
+	if err != nil {
+		return err
+	}
+	if t != c {
+		return t.Update(ctx, record)
+	}
+
+	return c.writeOnce(ctx, record, c.withRetry(c.withReconnect(c.withSchemaRefresh(c.withCastRetry(c.withAutoAddColumns(c.update))))))
+}
+
+func (c *sqlClient) Delete(ctx context.Context, record opencdc.Record) error {
+	t, err := c.forTable(ctx)
+	if err != nil {
+		return err
+	}
+	if t != c {
+		return t.Delete(ctx, record)
+	}
+
+	return c.writeOnce(ctx, record, c.withRetry(c.withReconnect(c.withSchemaRefresh(c.delete))))
+}
+
+// withSchemaRefresh returns a writeFunc which, if enabled, refreshes the
+// cached column information and retries the write once, when the write
+// fails because the table schema changed.
+func (c *sqlClient) withSchemaRefresh(write writeFunc) writeFunc {
+	return func(ctx context.Context, record opencdc.Record) error {
+		err := write(ctx, record)
+		if err == nil || !c.config.SchemaRefreshOnError || !isSchemaError(err) {
+			return err
+		}
+
+		sdk.Logger(ctx).Debug().Err(err).Msg("write failed because of a schema change, refreshing column information")
+		if refreshErr := c.refreshColumns(ctx); refreshErr != nil {
+			return fmt.Errorf("unable to refresh column information: %w (write error: %w)", refreshErr, err)
+		}
+
+		return write(ctx, record)
+	}
+}
+
+func (c *sqlClient) insert(ctx context.Context, record opencdc.Record) error {
+	sdk.Logger(ctx).Trace().Msg("inserting record")
+	if c.config.UseParameterizedStatements {
+		return c.insertParameterized(ctx, record)
+	}
+
+	insertValues, err := c.insertValues(ctx, record)
+	if err != nil {
+		return err
+	}
+	insertValues = c.castToColumnType(ctx, insertValues)
 
 	sqlString, err := c.queryBuilder.buildInsert(c.tableName, insertValues)
 	if err != nil {
 		return fmt.Errorf("failed building query: %w", err)
 	}
-	sdk.Logger(ctx).Trace().Msgf("insert sql string\n%v\n", sqlString)
+	sdk.Logger(ctx).Trace().Msgf("insert sql string\n%v\n", c.loggedSQL(sqlString))
 
-	// Currently, Databricks doesn't support prepared statements
-	// sqlString here comes with all the values filled in.
-	// However, it looks like Databricks is close to supporting it:
-	// https://github.com/databricks/databricks-sql-go/issues/84#issuecomment-1516815045
+	// sqlString here comes with all the values filled in,
+	// with useParameterizedStatements they're passed as parameters instead.
 	stmt, err := c.db.Prepare(sqlString)
 	if err != nil {
-		return fmt.Errorf("failed to prepare db statement: %w", err)
+		return fmt.Errorf("failed to prepare db statement: %w", classifyError(err))
 	}
 	defer stmt.Close()
 
-	res, err := stmt.ExecContext(ctx)
+	queryCtx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	res, err := stmt.ExecContext(queryCtx)
+	c.logIfSlow(ctx, sqlString, start)
+	if err != nil {
+		return fmt.Errorf("failed to execute db statement: %w ", classifyError(timeoutError(ctx, queryCtx, err)))
+	}
+
+	return c.checkInserted(res, 1)
+}
+
+// insertParameterized inserts the record with a statement which passes
+// the values as parameters, instead of having them in the SQL string.
+func (c *sqlClient) insertParameterized(ctx context.Context, record opencdc.Record) error {
+	values, err := c.recordValues(ctx, record)
 	if err != nil {
-		return fmt.Errorf("failed to execute db statement: %w ", err)
+		return err
+	}
+	values, err = c.convertValuesWith(values, c.parameterValue)
+	if err != nil {
+		return err
 	}
 
+	sqlString, args, err := c.queryBuilder.buildInsertParameterized(c.tableName, values, c.castTypes(ctx, values))
+	if err != nil {
+		return fmt.Errorf("failed building query: %w", err)
+	}
+	sdk.Logger(ctx).Trace().Msgf("insert sql string\n%v\n", c.loggedSQL(sqlString))
+
+	queryCtx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	res, err := c.db.ExecContext(queryCtx, sqlString, args...)
+	c.logIfSlow(ctx, sqlString, start)
+	if err != nil {
+		return fmt.Errorf("failed to execute db statement: %w ", classifyError(timeoutError(ctx, queryCtx, err)))
+	}
+
+	return c.checkInserted(res, 1)
+}
+
+// insertValues returns the converted values, with which the record is inserted.
+func (c *sqlClient) insertValues(ctx context.Context, record opencdc.Record) (map[string]interface{}, error) {
+	values, err := c.recordValues(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.convertValues(values)
+}
+
+// recordValues returns the values of the key and payload of the record,
+// merged, with normalized column names and the metadata columns added.
+func (c *sqlClient) recordValues(ctx context.Context, record opencdc.Record) (map[string]interface{}, error) {
+	payload := make(opencdc.StructuredData)
+	if err := unmarshalData(record.Payload.After.Bytes(), &payload); err != nil {
+		return nil, fmt.Errorf("error unmarshalling payload: %w", err)
+	}
+
+	key := make(opencdc.StructuredData)
+	if err := unmarshalData(record.Key.Bytes(), &key); err != nil {
+		return nil, fmt.Errorf("error unmarshalling key: %w", err)
+	}
+
+	payload, err := c.normalizeColumnNames(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	payload = c.filterColumns(payload)
+	key, err = c.normalizeColumnNames(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := c.merge(payload, key)
+	c.withMetadataColumns(merged, record.Metadata)
+
+	return merged, nil
+}
+
+// checkInserted checks the number of rows affected by an insert of
+// the given number of rows, as configured by insertAffectedCheck.
+func (c *sqlClient) checkInserted(res sql.Result, rows int64) error {
+	if c.config.InsertAffectedCheck == insertAffectedNone {
+		return nil
+	}
 	affected, err := res.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to get number of affected rows: %w ", err)
 	}
-	if affected != 1 {
+	if c.config.InsertAffectedCheck == insertAffectedAtLeastOne {
+		if affected < rows {
+			return fmt.Errorf("%v rows inserted", affected)
+		}
+		return nil
+	}
+	if affected != rows {
 		return fmt.Errorf("%v rows inserted", affected)
 	}
 
 	return nil
 }
 
-func (c *sqlClient) Update(ctx context.Context, record opencdc.Record) error {
+func (c *sqlClient) upsert(ctx context.Context, record opencdc.Record) error {
+	sdk.Logger(ctx).Trace().Msg("upserting record")
+
+	key, err := c.resolveKey(ctx, record)
+	if err != nil {
+		return err
+	}
+	values, err := c.insertValues(ctx, record)
+	if err != nil {
+		return err
+	}
+	values = c.castToColumnType(ctx, values)
+
+	keys := make(map[string]interface{}, len(key.columns))
+	for _, col := range key.columns {
+		keys[col] = values[col]
+	}
+	sqlString, err := c.queryBuilder.buildUpsert(c.tableName, keys, values)
+	if err != nil {
+		return fmt.Errorf("failed building upsert query: %w", err)
+	}
+	sdk.Logger(ctx).Trace().Msgf("upsert sql string\n%v\n", c.loggedSQL(sqlString))
+
+	// a MERGE either updates or inserts a single row,
+	// so there's no need to check the number of affected rows
+	_, err = c.execContext(ctx, sqlString)
+	if err != nil {
+		return fmt.Errorf("failed upsert: %w", classifyError(err))
+	}
+
+	return nil
+}
+
+func (c *sqlClient) update(ctx context.Context, record opencdc.Record) error {
 	sdk.Logger(ctx).Trace().Msg("updating record")
 
 	// nothing to update
@@ -154,79 +611,295 @@ func (c *sqlClient) Update(ctx context.Context, record opencdc.Record) error {
 	}
 
 	payload := make(opencdc.StructuredData)
-	if err := json.Unmarshal(record.Payload.After.Bytes(), &payload); err != nil {
+	if err := unmarshalData(record.Payload.After.Bytes(), &payload); err != nil {
 		return fmt.Errorf("error unmarshalling payload: %w", err)
 	}
+	payload, err := c.normalizeColumnNames(ctx, payload)
+	if err != nil {
+		return err
+	}
+	payload = c.filterColumns(payload)
 
-	key := make(opencdc.StructuredData)
-	if err := json.Unmarshal(record.Key.Bytes(), &key); err != nil {
-		return fmt.Errorf("error unmarshalling key: %w", err)
+	if c.config.DiffUpdates && record.Payload.Before != nil && len(record.Payload.Before.Bytes()) > 0 {
+		before := make(opencdc.StructuredData)
+		if err := unmarshalData(record.Payload.Before.Bytes(), &before); err != nil {
+			return fmt.Errorf("error unmarshalling payload before: %w", err)
+		}
+		before, err = c.normalizeColumnNames(ctx, before)
+		if err != nil {
+			return err
+		}
+		payload = c.changedValues(payload, before)
+		if len(payload) == 0 {
+			sdk.Logger(ctx).Trace().Msg("no columns changed, skipping update")
+			return nil
+		}
+	}
+
+	key, err := c.resolveKey(ctx, record)
+	if err != nil {
+		return err
 	}
 
-	sqlString, err := c.queryBuilder.buildUpdate(c.tableName, key, payload)
+	// fields which are null in the payload set their column to NULL,
+	// columns of fields missing from it are left as they are
+	c.withMetadataColumns(payload, record.Metadata)
+	values, err := c.convertValues(payload)
+	if err != nil {
+		return err
+	}
+	values = c.castToColumnType(ctx, values)
+
+	sqlString, err := c.queryBuilder.buildUpdate(c.tableName, key, values)
 	if err != nil {
 		return fmt.Errorf("failed building update query: %w", err)
 	}
-	sdk.Logger(ctx).Trace().Msgf("update sql string\n%v\n", sqlString)
+	sdk.Logger(ctx).Trace().Msgf("update sql string\n%v\n", c.loggedSQL(sqlString))
 
 	// we're not checking the number of affected rows
 	// as we're not even sure that a row with the same key has already been inserted
-	_, err = c.db.ExecContext(ctx, sqlString)
+	_, err = c.execContext(ctx, sqlString)
 	if err != nil {
-		return fmt.Errorf("failed update: %w", err)
+		return fmt.Errorf("failed update: %w", classifyError(err))
 	}
 
 	return nil
 }
 
-func (c *sqlClient) Delete(ctx context.Context, record opencdc.Record) error {
+func (c *sqlClient) delete(ctx context.Context, record opencdc.Record) error {
 	sdk.Logger(ctx).Trace().Msg("deleting record")
 
-	key := make(opencdc.StructuredData)
-	if err := json.Unmarshal(record.Key.Bytes(), &key); err != nil {
-		return fmt.Errorf("error unmarshalling key: %w", err)
+	if len(c.config.KeyColumns) == 0 && (record.Key == nil || len(record.Key.Bytes()) == 0) {
+		return ErrNoKeyForDelete
+	}
+	key, err := c.resolveKey(ctx, record)
+	if err != nil {
+		return err
+	}
+	if len(key.columns) == 0 {
+		return ErrNoKeyForDelete
 	}
 
-	sqlString, err := c.queryBuilder.buildDelete(c.tableName, key)
+	sqlString, err := c.buildDelete(key)
 	if err != nil {
 		return fmt.Errorf("failed building delete query: %w", err)
 	}
-	sdk.Logger(ctx).Trace().Msgf("delete sql string\n%v\n", sqlString)
+	sdk.Logger(ctx).Trace().Msgf("delete sql string\n%v\n", c.loggedSQL(sqlString))
 
 	// we're not checking the number of affected rows
 	// as we're not even sure that a row with the same key has already been inserted
-	_, err = c.db.ExecContext(ctx, sqlString)
+	_, err = c.execContext(ctx, sqlString)
 	if err != nil {
-		return fmt.Errorf("failed delete: %w", err)
+		return fmt.Errorf("failed delete: %w", classifyError(err))
 	}
 
 	return nil
 }
 
-// getColumnInfo gets information on all the column names and types and stores them
-func (c *sqlClient) getColumnInfo() error {
-	// we'll ignore the comment
-	var ignore sql.NullString
+// resolveKey extracts the key of a record, ordering its columns as they
+// appear in the table. If key columns are configured, the key consists
+// of exactly those columns.
+func (c *sqlClient) resolveKey(ctx context.Context, record opencdc.Record) (recordKey, error) {
+	if len(c.config.KeyColumns) > 0 {
+		return c.resolveKeyColumns(ctx, record)
+	}
 
-	rows, err := c.db.Query(c.queryBuilder.describeTable(c.tableName))
+	key := make(opencdc.StructuredData)
+	if err := unmarshalData(record.Key.Bytes(), &key); err != nil {
+		return recordKey{}, fmt.Errorf("error unmarshalling key: %w", err)
+	}
+
+	key, err := c.normalizeColumnNames(ctx, key)
 	if err != nil {
-		return fmt.Errorf("failed to execute describe query: %v", err)
+		return recordKey{}, err
+	}
+
+	return newRecordKey(key, c.columnNames()), nil
+}
+
+// resolveKeyColumns extracts the values of the configured key columns
+// from the key of a record, falling back to its payload.
+func (c *sqlClient) resolveKeyColumns(ctx context.Context, record opencdc.Record) (recordKey, error) {
+	values := make(map[string]interface{}, len(c.config.KeyColumns))
+	for _, data := range []opencdc.Data{record.Key, record.Payload.After, record.Payload.Before} {
+		if data == nil || len(data.Bytes()) == 0 {
+			continue
+		}
+		fields := make(opencdc.StructuredData)
+		if err := unmarshalData(data.Bytes(), &fields); err != nil {
+			return recordKey{}, fmt.Errorf("error unmarshalling record data: %w", err)
+		}
+		fields, err := c.normalizeColumnNames(ctx, fields)
+		if err != nil {
+			return recordKey{}, err
+		}
+
+		for _, col := range c.config.KeyColumns {
+			if _, ok := values[col]; ok {
+				continue
+			}
+			if v, ok := fields[col]; ok {
+				values[col] = v
+			}
+		}
+	}
+
+	for _, col := range c.config.KeyColumns {
+		if _, ok := values[col]; !ok {
+			return recordKey{}, fmt.Errorf("record has no value for key column %q", col)
+		}
+	}
+
+	return recordKey{columns: c.config.KeyColumns, values: values}, nil
+}
+
+// schemaPermissionBackoff holds the waits before retrying DESCRIBE after
+// a permission error, if retrySchemaOnPermission is enabled.
+var schemaPermissionBackoff = []time.Duration{
+	time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second,
+}
+
+// getColumnInfoWithRetry gets the column information. Permissions granted in
+// Unity Catalog take a moment to propagate, so with retrySchemaOnPermission
+// enabled, permission errors are retried with a backoff. Transient errors
+// can't be told apart from permanent ones, so a permanent denial is returned
+// once the retries are exhausted.
+func (c *sqlClient) getColumnInfoWithRetry(ctx context.Context) error {
+	err := c.getColumnInfo(ctx)
+	if !c.config.RetrySchemaOnPermission {
+		return err
+	}
+
+	for _, wait := range schemaPermissionBackoff {
+		if err == nil || !errors.Is(err, ErrPermissionDenied) {
+			return err
+		}
+		sdk.Logger(ctx).Warn().Err(err).Dur("wait", wait).Msg("permission denied describing the table, retrying")
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-time.After(wait):
+		}
+		err = c.getColumnInfo(ctx)
+	}
+
+	return err
+}
+
+// getColumnInfo gets information on all the column names and types and stores them.
+// Column comments are stored too, if captureColumnComments is enabled.
+func (c *sqlClient) getColumnInfo(ctx context.Context) error {
+	queryCtx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	query := c.queryBuilder.describeTable(c.tableName)
+	start := time.Now()
+	rows, err := c.db.QueryContext(queryCtx, query)
+	c.logIfSlow(ctx, query, start)
+	if err != nil {
+		return fmt.Errorf("failed to execute describe query: %w", classifyError(timeoutError(ctx, queryCtx, err)))
 	}
 	defer rows.Close()
 
+	var columns []string
+	columnTypes := make(map[string]string)
+	columnsByLower := make(map[string]string)
+	var columnComments map[string]string
+	if c.config.CaptureColumnComments {
+		columnComments = make(map[string]string)
+	}
 	for rows.Next() {
 		var colName string
-		err := rows.Scan(&colName, &ignore, &ignore)
+		var dataType, comment sql.NullString
+		err := rows.Scan(&colName, &dataType, &comment)
 		if err != nil {
 			return fmt.Errorf("failed to next(): %v", err)
 		}
+		// for partitioned tables, the columns are followed by an empty row
+		// and a "# Partition Information" section repeating the partition
+		// columns
+		if strings.TrimSpace(colName) == "" || strings.HasPrefix(colName, "#") {
+			break
+		}
 
-		c.columns = append(c.columns, colName)
+		columns = append(columns, colName)
+		columnTypes[colName] = dataType.String
+		columnsByLower[strings.ToLower(colName)] = colName
+		if columnComments != nil && comment.Valid {
+			columnComments[colName] = comment.String
+		}
 	}
 
+	c.columnsMu.Lock()
+	c.columns = columns
+	c.columnTypes = columnTypes
+	c.columnsByLower = columnsByLower
+	c.columnComments = columnComments
+	c.columnsMu.Unlock()
+
 	return nil
 }
 
+// withQueryTimeout returns a context bounded by the query timeout,
+// if one is configured.
+func (c *sqlClient) withQueryTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.config.QueryTimeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, c.config.QueryTimeout)
+}
+
+// timeoutError wraps err in ErrQueryTimeout, if the statement executed with
+// queryCtx ran into the query timeout, rather than ctx being done.
+func timeoutError(ctx, queryCtx context.Context, err error) error {
+	if err != nil && ctx.Err() == nil && errors.Is(queryCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrQueryTimeout, err)
+	}
+
+	return err
+}
+
+// execContext executes a statement, bounded by the query timeout.
+func (c *sqlClient) execContext(ctx context.Context, query string) (sql.Result, error) {
+	queryCtx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+	res, err := c.db.ExecContext(queryCtx, query)
+	c.logIfSlow(ctx, query, start)
+	return res, timeoutError(ctx, queryCtx, err)
+}
+
+// loggedSQL returns sqlString as it's logged, truncated to
+// the configured maximum length. The string is cut at the start of
+// a character, so multi-byte characters aren't split.
+func (c *sqlClient) loggedSQL(sqlString string) string {
+	if c.config.MaxLoggedSQLLength <= 0 || len(sqlString) <= c.config.MaxLoggedSQLLength {
+		return sqlString
+	}
+
+	n := c.config.MaxLoggedSQLLength
+	for n > 0 && !utf8.RuneStart(sqlString[n]) {
+		n--
+	}
+
+	return fmt.Sprintf("%s... (truncated, %v bytes in total)", sqlString[:n], len(sqlString))
+}
+
+// changedValues returns the values in after which are different
+// from, or missing in before.
+func (c *sqlClient) changedValues(after, before map[string]interface{}) opencdc.StructuredData {
+	changed := make(opencdc.StructuredData)
+	for k, v := range after {
+		if bv, ok := before[k]; !ok || !reflect.DeepEqual(v, bv) {
+			changed[k] = v
+		}
+	}
+
+	return changed
+}
+
 func (c *sqlClient) merge(m1, m2 map[string]interface{}) map[string]interface{} {
 	merged := make(map[string]interface{})
 	for k, v := range m1 {
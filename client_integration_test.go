@@ -220,6 +220,50 @@ func TestSqlClient_Insert_NonExistingColumn(t *testing.T) {
 	))
 }
 
+func TestSqlClient_Insert_Binary(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	th, err := newTestHelper()
+	if errors.Is(err, errMissingConfig) {
+		t.Skipf("configuration not provided")
+	}
+	is.NoErr(err)
+	defer func() {
+		is.NoErr(th.cleanup())
+	}()
+
+	_, err = th.db.ExecContext(ctx, "ALTER TABLE "+th.cfg.TableName+" ADD COLUMNS (content binary)")
+	is.NoErr(err)
+
+	want := []byte{0x00, 0x01, 0x02, 0xfe, 0xff}
+	for _, parameterized := range []bool{false, true} {
+		underTest := newClient()
+		cfg := th.cfg
+		cfg.UseParameterizedStatements = parameterized
+		is.NoErr(underTest.Open(ctx, cfg))
+
+		// structured data is sent as JSON, so the bytes arrive base64 encoded
+		id := 1
+		if parameterized {
+			id = 2
+		}
+		err = underTest.Insert(ctx, opencdc.Record{
+			Position:  opencdc.Position("test-pos"),
+			Operation: opencdc.OperationCreate,
+			Key:       opencdc.StructuredData{"id": id},
+			Payload:   opencdc.Change{After: opencdc.StructuredData{"content": want}},
+		})
+		is.NoErr(err)
+		is.NoErr(underTest.Close())
+
+		var got []byte
+		row := th.db.QueryRowContext(ctx, "SELECT content FROM "+th.cfg.TableName+" WHERE id = ?", id) //nolint:gosec // ok since this is a test
+		is.NoErr(row.Scan(&got))
+		is.Equal(want, got)
+	}
+}
+
 func TestClient_Update_DoesntExist(t *testing.T) {
 	is := is.New(t)
 	ctx := context.Background()
@@ -376,6 +420,52 @@ func TestClient_Delete_Exists(t *testing.T) {
 	is.True(!rows.Next())
 }
 
+func TestClient_Delete_SoftDelete(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	underTest := newClient()
+	th, err := newTestHelper()
+	if errors.Is(err, errMissingConfig) {
+		t.Skipf("configuration not provided")
+	}
+	is.NoErr(err)
+	defer func() {
+		is.NoErr(th.cleanup())
+	}()
+
+	cfg := th.cfg
+	cfg.SoftDeleteColumn = "full_time"
+	err = underTest.Open(ctx, cfg)
+	is.NoErr(err)
+
+	// insert row
+	id := 123
+	q, _, err := dialect.Insert(th.cfg.TableName).
+		Cols("id", "name", "full_time", "updated_at").
+		Vals([]interface{}{id, "bye bye", false, time.Now().Add(-time.Hour).Truncate(time.Millisecond).UTC()}).
+		ToSQL()
+	is.NoErr(err)
+	_, err = th.db.ExecContext(ctx, q)
+	is.NoErr(err)
+
+	err = underTest.Delete(ctx, opencdc.Record{
+		Position:  opencdc.Position("test-pos"),
+		Operation: opencdc.OperationDelete,
+		Key:       opencdc.StructuredData{"id": id},
+	})
+	is.NoErr(err)
+
+	// the row remains, flagged as deleted
+	var name string
+	var deleted bool
+	row := th.db.QueryRowContext(ctx, "SELECT name, full_time FROM "+th.cfg.TableName+" WHERE id = 123") //nolint:gosec // ok since this is a test
+	err = row.Scan(&name, &deleted)
+	is.NoErr(err)
+	is.Equal("bye bye", name)
+	is.True(deleted)
+}
+
 func TestClient_Delete_DoesntExist(t *testing.T) {
 	is := is.New(t)
 	ctx := context.Background()
@@ -0,0 +1,75 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+)
+
+// filterColumns returns the fields of data which are written to the table,
+// i.e. the fields in includeColumns, if it's set, and not in excludeColumns.
+// The field names are compared ignoring case, like column names.
+func (c *sqlClient) filterColumns(data opencdc.StructuredData) opencdc.StructuredData {
+	if len(c.config.IncludeColumns) == 0 && len(c.config.ExcludeColumns) == 0 {
+		return data
+	}
+
+	filtered := make(opencdc.StructuredData, len(data))
+	for field, v := range data {
+		if len(c.config.IncludeColumns) > 0 && !containsFold(c.config.IncludeColumns, field) {
+			continue
+		}
+		if containsFold(c.config.ExcludeColumns, field) {
+			continue
+		}
+		filtered[field] = v
+	}
+	return filtered
+}
+
+// validateColumnFilter checks that includeColumns and excludeColumns don't
+// contradict each other or the key columns.
+func (c Config) validateColumnFilter() error {
+	var errs []error
+	for _, col := range c.ExcludeColumns {
+		if containsFold(c.IncludeColumns, col) {
+			errs = append(errs, fmt.Errorf("column %q is in both %v and %v", col, ConfigIncludeColumns, ConfigExcludeColumns))
+		}
+	}
+	for _, col := range c.KeyColumns {
+		if containsFold(c.ExcludeColumns, col) {
+			errs = append(errs, fmt.Errorf("key column %q can't be in %v", col, ConfigExcludeColumns))
+		}
+		if len(c.IncludeColumns) > 0 && !containsFold(c.IncludeColumns, col) {
+			errs = append(errs, fmt.Errorf("key column %q needs to be in %v", col, ConfigIncludeColumns))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// containsFold returns true if list contains s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// columnFor returns the column field is written to, i.e. the column it's
+// mapped to in columnMapping, or its name normalized as configured by
+// columnNameNormalize otherwise.
+func (c *sqlClient) columnFor(field string) string {
+	if column, ok := c.config.ColumnMapping[field]; ok {
+		return column
+	}
+	if c.config.ColumnNameNormalize == columnNameLower || c.config.ColumnNameNormalize == columnNameSnake {
+		return normalizeColumnName(field, c.config.ColumnNameNormalize)
+	}
+	return field
+}
+
+// validateColumnMapping checks the names of the columns
+// fields are mapped to in columnMapping. Errors name the
+// parameter of the field, e.g. columnMapping.userId.
+func (c Config) validateColumnMapping() error {
+	for field, column := range c.ColumnMapping {
+		if err := validateColumnNames(column); err != nil {
+			return fmt.Errorf("invalid %v: %w", strings.Replace(ConfigColumnMapping, "*", field, 1), err)
+		}
+	}
+	return nil
+}
+
+// checkMappedColumns checks that the columns fields are mapped to exist in
+// the table. They're not checked if missing columns are added automatically.
+func (c *sqlClient) checkMappedColumns() error {
+	if c.config.AutoAddColumns {
+		return nil
+	}
+
+	// fields are checked in lexical order, so the error is deterministic
+	fields := make([]string, 0, len(c.config.ColumnMapping))
+	for field := range c.config.ColumnMapping {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if column := c.config.ColumnMapping[field]; !c.hasColumn(column) {
+			return fmt.Errorf("column %q, which field %q is mapped to, not found in table %v", column, field, c.tableName)
+		}
+	}
+	return nil
+}
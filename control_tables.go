@@ -0,0 +1,140 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Default column names of the positions table.
+const (
+	defaultPositionsTableColumn    = "table_name"
+	defaultPositionsPositionColumn = "position"
+)
+
+// controlColumn is a column of a control table.
+type controlColumn struct {
+	name     string
+	dataType string
+}
+
+// controlTable is an auxiliary table in which the connector keeps its own
+// state, like the positions table used in exactly-once mode.
+type controlTable struct {
+	name    string
+	columns []controlColumn
+}
+
+// createStatement returns the statement creating the table,
+// unless it exists.
+func (t controlTable) createStatement(b queryBuilder) string {
+	columns := make([]string, len(t.columns))
+	types := make(map[string]string, len(t.columns))
+	for i, col := range t.columns {
+		columns[i] = col.name
+		types[col.name] = col.dataType
+	}
+
+	return b.createTable(t.name, columns, types)
+}
+
+// positionsControlTable returns the control table which holds
+// the positions of records written in exactly-once mode.
+func (c *sqlClient) positionsControlTable() controlTable {
+	return controlTable{
+		name: c.positionsTable(),
+		columns: []controlColumn{
+			{name: c.positionsTableColumn(), dataType: "STRING"},
+			{name: c.positionsPositionColumn(), dataType: "STRING"},
+		},
+	}
+}
+
+// positionsTableColumn returns the column of the positions table
+// holding the name of the table a record was written to.
+func (c *sqlClient) positionsTableColumn() string {
+	if c.config.PositionsTableColumn != "" {
+		return c.config.PositionsTableColumn
+	}
+
+	return defaultPositionsTableColumn
+}
+
+// positionsPositionColumn returns the column of the positions
+// table holding the position of a written record.
+func (c *sqlClient) positionsPositionColumn() string {
+	if c.config.PositionsPositionColumn != "" {
+		return c.config.PositionsPositionColumn
+	}
+
+	return defaultPositionsPositionColumn
+}
+
+// openControlTable creates the control table, if autoCreateControlTables is
+// enabled. Otherwise, it checks that the table exists with the expected columns.
+func (c *sqlClient) openControlTable(ctx context.Context, table controlTable) error {
+	if c.config.AutoCreateControlTables {
+		if _, err := c.execContext(ctx, table.createStatement(c.queryBuilder)); err != nil {
+			return fmt.Errorf("failed creating control table %v: %w", table.name, classifyError(err))
+		}
+		return nil
+	}
+
+	types, err := c.describeControlTable(ctx, table.name)
+	if err != nil {
+		return err
+	}
+	for _, col := range table.columns {
+		dataType, ok := types[col.name]
+		if !ok {
+			return fmt.Errorf("control table %v has no column %q", table.name, col.name)
+		}
+		if !strings.EqualFold(dataType, col.dataType) {
+			return fmt.Errorf("column %q of control table %v has type %v, expected %v", col.name, table.name, dataType, col.dataType)
+		}
+	}
+
+	return nil
+}
+
+// describeControlTable returns the types of the columns of a control table.
+func (c *sqlClient) describeControlTable(ctx context.Context, table string) (map[string]string, error) {
+	queryCtx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	query := c.queryBuilder.describeTable(table)
+	start := time.Now()
+	rows, err := c.db.QueryContext(queryCtx, query)
+	c.logIfSlow(ctx, query, start)
+	if err != nil {
+		return nil, fmt.Errorf("failed describing control table %v: %w", table, classifyError(timeoutError(ctx, queryCtx, err)))
+	}
+	defer rows.Close()
+
+	types := make(map[string]string)
+	for rows.Next() {
+		var colName string
+		var dataType, comment sql.NullString
+		if err := rows.Scan(&colName, &dataType, &comment); err != nil {
+			return nil, fmt.Errorf("failed to next(): %w", err)
+		}
+		types[colName] = dataType.String
+	}
+
+	return types, rows.Err()
+}
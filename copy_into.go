@@ -0,0 +1,314 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/databricks/databricks-sql-go/driverctx"
+)
+
+// Load modes of create and snapshot records.
+const (
+	loadModeInsert = "insert"
+	loadModeCopy   = "copy"
+)
+
+// Formats of the files staged with the copy load mode.
+const (
+	stagingFormatJSON = "json"
+	stagingFormatCSV  = "csv"
+)
+
+// CopyInto loads the records into the table with COPY INTO. The records are
+// written to files of at most stagingMaxRows rows and stagingMaxBytes bytes,
+// which are uploaded to the staging path and loaded one by one. Staged files
+// are removed once they're loaded.
+func (c *sqlClient) CopyInto(ctx context.Context, records []opencdc.Record) error {
+	t, err := c.forTable(ctx)
+	if err != nil {
+		return err
+	}
+	if t != c {
+		return t.CopyInto(ctx, records)
+	}
+
+	c.refreshColumnsIfDue(ctx)
+	if len(records) > 0 {
+		if err := c.createTableFor(ctx, records[0]); err != nil {
+			return err
+		}
+	}
+	if err := c.addMissingColumns(ctx, records...); err != nil {
+		return err
+	}
+
+	rows := make([]map[string]interface{}, len(records))
+	for i, r := range records {
+		v, err := c.stagedValues(ctx, r)
+		if err != nil {
+			return fmt.Errorf("failed getting values of record %v: %w", i, err)
+		}
+		rows[i] = v
+	}
+
+	copied := 0
+	for copied < len(rows) {
+		file, n, err := c.stagingFile(rows[copied:])
+		if err != nil {
+			return err
+		}
+		dir, name, err := writeStagingFile(file, c.stagingFormat())
+		if err != nil {
+			return err
+		}
+
+		// retries load the same file, which COPY INTO skips if
+		// the failed attempt loaded it already
+		attempts := 0
+		err = c.retryOnError(ctx, func(ctx context.Context) error {
+			return c.reconnectOnError(ctx, func(ctx context.Context) error {
+				attempts++
+				return c.copyFile(ctx, dir, name, n, attempts > 1)
+			})
+		})
+		os.RemoveAll(dir)
+		if err != nil {
+			if copied > 0 {
+				return &BatchError{Written: copied, Err: err}
+			}
+			return err
+		}
+		copied += n
+	}
+
+	return nil
+}
+
+// stagedValues returns the values with which the record is written to a
+// staged file. They're converted like inserted values, except that they're
+// plain values instead of SQL literals.
+func (c *sqlClient) stagedValues(ctx context.Context, record opencdc.Record) (map[string]interface{}, error) {
+	values, err := c.recordValues(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.convertValuesWith(values, c.stagedValue)
+}
+
+// stagedValue converts v into the value written to a staged file. CSV files
+// have no nested values, so JSON objects and arrays are written as strings.
+func (c *sqlClient) stagedValue(col string, v interface{}) (interface{}, error) {
+	v, err := c.plainValue(col, v)
+	if err != nil {
+		return nil, err
+	}
+	if isComplexValue(v) && c.stagingFormat() == stagingFormatCSV {
+		return jsonString(v)
+	}
+
+	return v, nil
+}
+
+// stagingFile encodes rows from the start of rows into the contents of a
+// staged file, until the file reaches the configured maximum number of
+// rows or bytes. It returns the contents and the number of rows encoded,
+// which is at least one.
+func (c *sqlClient) stagingFile(rows []map[string]interface{}) ([]byte, int, error) {
+	if c.stagingFormat() == stagingFormatCSV {
+		return c.csvFile(rows)
+	}
+
+	var buf bytes.Buffer
+	n := 0
+	for ; n < len(rows) && c.fits(n, buf.Len()); n++ {
+		b, err := json.Marshal(rows[n])
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed encoding record %v as JSON: %w", n, err)
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes(), n, nil
+}
+
+// csvFile encodes rows as CSV with a header. Since the columns of all rows
+// need to line up, they're the columns of all rows, not only of the rows
+// which end up in the file. Missing and null values are left empty.
+func (c *sqlClient) csvFile(rows []map[string]interface{}) ([]byte, int, error) {
+	columns := batchColumns(rows)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(columns); err != nil {
+		return nil, 0, fmt.Errorf("failed writing CSV header: %w", err)
+	}
+
+	n := 0
+	record := make([]string, len(columns))
+	for ; n < len(rows); n++ {
+		w.Flush()
+		if !c.fits(n, buf.Len()) {
+			break
+		}
+		for i, col := range columns {
+			v := rows[n][col]
+			if v == nil {
+				record[i] = ""
+				continue
+			}
+			record[i] = fmt.Sprint(v)
+		}
+		if err := w.Write(record); err != nil {
+			return nil, 0, fmt.Errorf("failed encoding record %v as CSV: %w", n, err)
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, 0, fmt.Errorf("failed encoding records as CSV: %w", err)
+	}
+
+	return buf.Bytes(), n, nil
+}
+
+// fits returns true if another row fits into a staged file which
+// already holds rows rows of size bytes.
+func (c *sqlClient) fits(rows, size int) bool {
+	if rows == 0 {
+		return true
+	}
+	if c.config.StagingMaxRows > 0 && rows >= c.config.StagingMaxRows {
+		return false
+	}
+
+	return c.config.StagingMaxBytes <= 0 || size < c.config.StagingMaxBytes
+}
+
+// writeStagingFile writes contents to a local file with a unique name, in
+// a new temporary directory, and returns the directory and the file name.
+// The file keeps its name when it's loaded again, so that COPY INTO, which
+// skips files it loaded before, doesn't load it twice.
+func writeStagingFile(contents []byte, format string) (string, string, error) {
+	name, err := stagingFileName(format)
+	if err != nil {
+		return "", "", err
+	}
+	dir, err := os.MkdirTemp("", "conduit-databricks-")
+	if err != nil {
+		return "", "", fmt.Errorf("failed creating temporary directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), contents, 0o600); err != nil {
+		os.RemoveAll(dir)
+		return "", "", fmt.Errorf("failed writing staging file: %w", err)
+	}
+
+	return dir, name, nil
+}
+
+// copyFile uploads the local file name in dir to the staging path, loads
+// it with COPY INTO and removes it again. A retried load of a file which
+// the failed attempt loaded already loads no rows, which isn't an error.
+func (c *sqlClient) copyFile(ctx context.Context, dir string, name string, rows int, retried bool) error {
+	local := filepath.Join(dir, name)
+	staged := strings.TrimSuffix(c.config.StagingPath, "/") + "/" + name
+	sdk.Logger(ctx).Debug().Msgf("staging %v records in %v", rows, staged)
+
+	// PUT and REMOVE are only allowed for local paths in the staging info
+	stagingCtx := driverctx.NewContextWithStagingInfo(ctx, []string{dir})
+	if _, err := c.execContext(stagingCtx, c.queryBuilder.putFile(local, staged)); err != nil {
+		return fmt.Errorf("failed uploading staging file: %w", classifyError(err))
+	}
+	defer func() {
+		if _, err := c.execContext(stagingCtx, c.queryBuilder.removeFile(staged)); err != nil {
+			sdk.Logger(ctx).Warn().Err(err).Msgf("failed removing staged file %v", staged)
+		}
+	}()
+
+	sqlString, err := c.queryBuilder.buildCopyInto(c.tableName, c.config.StagingPath, name, c.stagingFormat())
+	if err != nil {
+		return fmt.Errorf("failed building query: %w", err)
+	}
+	sdk.Logger(ctx).Trace().Msgf("copy into sql string\n%v\n", c.loggedSQL(sqlString))
+
+	res, err := c.execContext(ctx, sqlString)
+	if err != nil {
+		return fmt.Errorf("failed to execute db statement: %w", classifyError(err))
+	}
+	if retried {
+		if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+			sdk.Logger(ctx).Debug().Msgf("staged file %v was loaded by the failed attempt", staged)
+			return nil
+		}
+	}
+
+	return c.checkInserted(res, int64(rows))
+}
+
+// stagingFormat returns the format of staged files, JSON unless CSV
+// is configured.
+func (c *sqlClient) stagingFormat() string {
+	if c.config.StagingFileFormat == stagingFormatCSV {
+		return stagingFormatCSV
+	}
+
+	return stagingFormatJSON
+}
+
+// stagingFileName returns a unique name for a staged file in format.
+func stagingFileName(format string) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed generating staging file name: %w", err)
+	}
+
+	return fmt.Sprintf("conduit-%d-%s.%s", time.Now().UnixNano(), hex.EncodeToString(b), format), nil
+}
+
+// validateLoadMode checks that the copy load mode has a staging path,
+// and isn't combined with options requiring records to be inserted
+// one by one.
+func (c Config) validateLoadMode() error {
+	if c.LoadMode != loadModeCopy {
+		return nil
+	}
+
+	var errs []error
+	if c.StagingPath == "" {
+		errs = append(errs, fmt.Errorf("%v %q requires %v to be set", ConfigLoadMode, loadModeCopy, ConfigStagingPath))
+	}
+	if c.Upsert {
+		errs = append(errs, fmt.Errorf("%v %q can't be combined with %v", ConfigLoadMode, loadModeCopy, ConfigUpsert))
+	}
+	if c.ExactlyOnce {
+		errs = append(errs, fmt.Errorf("%v %q can't be combined with %v", ConfigLoadMode, loadModeCopy, ConfigExactlyOnce))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,150 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// createTableFor creates the table, if it was missing when opening, with
+// columns inferred from the fields of record. The key fields come first,
+// followed by the payload fields, both sorted by name.
+func (c *sqlClient) createTableFor(ctx context.Context, record opencdc.Record) error {
+	if !c.tableMissing {
+		return nil
+	}
+
+	columns, types, err := c.inferColumns(ctx, record)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("unable to create table %v: record has no fields", c.tableName)
+	}
+
+	sqlString := c.queryBuilder.createTable(c.tableName, columns, types)
+	sdk.Logger(ctx).Info().Msgf("creating table\n%v\n", sqlString)
+	if _, err := c.execContext(ctx, sqlString); err != nil {
+		return fmt.Errorf("failed creating table: %w", classifyError(err))
+	}
+
+	if err := c.refreshColumns(ctx); err != nil {
+		return fmt.Errorf("unable to get column information: %w", err)
+	}
+	if err := c.checkConfiguredColumns(); err != nil {
+		return err
+	}
+	c.tableMissing = false
+
+	return nil
+}
+
+// inferColumns returns the columns for the fields of records and their
+// inferred types. The key fields come first, followed by the payload fields,
+// both sorted by name. A field's type is inferred from the first record
+// which has it. Deletes, which have no payload after the change, contribute
+// the fields of the payload before the change.
+func (c *sqlClient) inferColumns(ctx context.Context, records ...opencdc.Record) ([]string, map[string]string, error) {
+	var columns []string
+	types := make(map[string]string)
+	for _, record := range records {
+		payload := record.Payload.After
+		if payload == nil || len(payload.Bytes()) == 0 {
+			payload = record.Payload.Before
+		}
+
+		for i, data := range []opencdc.Data{record.Key, payload} {
+			fields, err := typedFields(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			fields, err = c.normalizeColumnNames(ctx, fields)
+			if err != nil {
+				return nil, nil, err
+			}
+			if i == 1 {
+				fields = c.filterColumns(fields)
+			}
+
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				if _, ok := types[name]; !ok {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				columns = append(columns, name)
+				types[name] = inferColumnType(fields[name])
+			}
+		}
+	}
+
+	return columns, types, nil
+}
+
+// typedFields returns the fields of data. Structured data keeps its Go
+// types, JSON is decoded with numbers kept as json.Number, so integers
+// can be told apart from fractional numbers.
+func typedFields(data opencdc.Data) (opencdc.StructuredData, error) {
+	if sd, ok := data.(opencdc.StructuredData); ok {
+		return sd, nil
+	}
+	if data == nil || len(data.Bytes()) == 0 {
+		return opencdc.StructuredData{}, nil
+	}
+
+	fields := make(opencdc.StructuredData)
+	dec := json.NewDecoder(bytes.NewReader(data.Bytes()))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("error unmarshalling record data: %w", err)
+	}
+
+	return fields, nil
+}
+
+// inferColumnType returns the Databricks type of a column holding v.
+// Values whose type can't be told, like nulls, get STRING columns.
+func inferColumnType(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		return "BOOLEAN"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "BIGINT"
+	case float32, float64:
+		return "DOUBLE"
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "DOUBLE"
+		}
+		return "BIGINT"
+	case time.Time:
+		return "TIMESTAMP"
+	case []byte:
+		return "BINARY"
+	default:
+		return "STRING"
+	}
+}
@@ -15,13 +15,23 @@
 package databricks_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	databricks "github.com/conduitio-labs/conduit-connector-databricks"
 	"github.com/conduitio-labs/conduit-connector-databricks/mock"
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/conduitio/conduit-connector-protocol/pconnector"
 	sdk "github.com/conduitio/conduit-connector-sdk"
 	"github.com/matryer/is"
+	"github.com/rs/zerolog"
 	"go.uber.org/mock/gomock"
 )
 
@@ -33,6 +43,9 @@ func TestConfigure(t *testing.T) {
 	var cfg databricks.Config
 	err := sdk.Util.ParseConfig(ctx, cfgMap, &cfg, databricks.NewDestination().Parameters())
 	is.NoErr(err)
+	// writes are serial, so a single connection is used by default
+	is.Equal(1, cfg.MaxOpenConns)
+	is.Equal(1, cfg.MaxIdleConns)
 
 	underTest := databricks.NewDestinationWithClient(client)
 	err = underTest.Configure(ctx, cfgMap)
@@ -43,6 +56,1359 @@ func TestConfigure(t *testing.T) {
 	is.NoErr(err)
 }
 
+func TestConfigure_EnvFallback(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := mock.NewClient(gomock.NewController(t))
+
+	t.Setenv("DATABRICKS_HOST", "env-host")
+	t.Setenv("DATABRICKS_PORT", "8443")
+	t.Setenv("DATABRICKS_HTTP_PATH", "env-path")
+	t.Setenv("DATABRICKS_TABLE_NAME", "env-table")
+
+	underTest := databricks.NewDestinationWithClient(client)
+	// explicit config takes precedence over the environment
+	err := underTest.Configure(ctx, map[string]string{"token": "test", "httpPath": "test"})
+	is.NoErr(err)
+
+	var want databricks.Config
+	err = sdk.Util.ParseConfig(ctx, map[string]string{
+		"token":     "test",
+		"host":      "env-host",
+		"port":      "8443",
+		"httpPath":  "test",
+		"tableName": "env-table",
+	}, &want, databricks.NewDestination().Parameters())
+	is.NoErr(err)
+
+	client.EXPECT().Open(gomock.Any(), want).Return(nil)
+	err = underTest.Open(ctx)
+	is.NoErr(err)
+}
+
+func TestConfigure_EnvFallback_Missing(t *testing.T) {
+	is := is.New(t)
+
+	t.Setenv("DATABRICKS_HOST", "")
+	underTest := databricks.NewDestinationWithClient(mock.NewClient(gomock.NewController(t)))
+	err := underTest.Configure(context.Background(), map[string]string{"token": "test", "httpPath": "test", "tableName": "test"})
+	is.True(err != nil) // expected error for missing host
+}
+
+func TestConfigure_Host(t *testing.T) {
+	testCases := []struct {
+		host    string
+		wantErr string
+	}{
+		{host: "https://adb-1234.5.azuredatabricks.net/?o=1234"},
+		{host: "ftp://adb-1234.5.azuredatabricks.net", wantErr: `unsupported scheme "ftp"`},
+		{host: "adb-1234.5.azuredatabricks.net:443", wantErr: "needs to be a hostname"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := databricks.NewDestinationWithClient(mock.NewClient(gomock.NewController(t)))
+			err := underTest.Configure(context.Background(), map[string]string{
+				"token":     "test",
+				"host":      tc.host,
+				"httpPath":  "test",
+				"tableName": "test",
+			})
+			if tc.wantErr == "" {
+				is.NoErr(err)
+				return
+			}
+			is.True(err != nil)
+			is.True(strings.Contains(err.Error(), tc.wantErr))
+		})
+	}
+}
+
+func TestConfigure_DSN(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cfg     map[string]string
+		wantErr bool
+	}{
+		{
+			name: "dsn only",
+			cfg: map[string]string{
+				"dsn":       "token:dapi123@dbc-123.cloud.databricks.com:443/sql/1.0/warehouses/abc",
+				"tableName": "test",
+			},
+		},
+		{
+			name: "dsn and host",
+			cfg: map[string]string{
+				"dsn":       "token:dapi123@dbc-123.cloud.databricks.com:443/sql/1.0/warehouses/abc",
+				"host":      "dbc-123.cloud.databricks.com",
+				"tableName": "test",
+			},
+			wantErr: true,
+		},
+		{
+			name:    "neither dsn nor token",
+			cfg:     map[string]string{"host": "test", "httpPath": "test", "tableName": "test"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			t.Setenv("DATABRICKS_API_TOKEN", "")
+			t.Setenv("DATABRICKS_HOST", "")
+			t.Setenv("DATABRICKS_HTTP_PATH", "")
+
+			underTest := databricks.NewDestinationWithClient(mock.NewClient(gomock.NewController(t)))
+			err := underTest.Configure(context.Background(), tc.cfg)
+			if tc.wantErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+		})
+	}
+}
+
+func TestConfigure_Auth(t *testing.T) {
+	testCases := []struct {
+		name    string
+		auth    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "token",
+			auth: map[string]string{"token": "test"},
+		},
+		{
+			name: "client credentials",
+			auth: map[string]string{"clientId": "id", "clientSecret": "secret"},
+		},
+		{
+			name:    "token and client credentials",
+			auth:    map[string]string{"token": "test", "clientId": "id", "clientSecret": "secret"},
+			wantErr: true,
+		},
+		{
+			name:    "client ID without secret",
+			auth:    map[string]string{"clientId": "id"},
+			wantErr: true,
+		},
+		{
+			name:    "no authentication",
+			auth:    map[string]string{},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			t.Setenv("DATABRICKS_API_TOKEN", "")
+
+			cfg := map[string]string{"host": "test", "httpPath": "test", "tableName": "test"}
+			for k, v := range tc.auth {
+				cfg[k] = v
+			}
+
+			underTest := databricks.NewDestinationWithClient(mock.NewClient(gomock.NewController(t)))
+			err := underTest.Configure(context.Background(), cfg)
+			if tc.wantErr {
+				is.True(err != nil)
+				is.True(strings.Contains(err.Error(), "exactly one authentication method"))
+				return
+			}
+			is.NoErr(err)
+		})
+	}
+}
+
+func TestConfigure_Table(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cfg     map[string]string
+		wantErr bool
+	}{
+		{
+			name: "three-part name",
+			cfg:  map[string]string{"catalog": "main", "schema": "sales", "table": "order"},
+		},
+		{
+			name:    "catalog without table",
+			cfg:     map[string]string{"catalog": "main", "tableName": "main.sales.order"},
+			wantErr: true,
+		},
+		{
+			name:    "no table",
+			cfg:     map[string]string{},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			t.Setenv("DATABRICKS_TABLE_NAME", "")
+
+			cfg := map[string]string{"token": "test", "host": "test", "httpPath": "test"}
+			for k, v := range tc.cfg {
+				cfg[k] = v
+			}
+
+			underTest := databricks.NewDestinationWithClient(mock.NewClient(gomock.NewController(t)))
+			err := underTest.Configure(context.Background(), cfg)
+			if tc.wantErr {
+				is.True(err != nil)
+				return
+			}
+			is.NoErr(err)
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := func() databricks.Config {
+		return databricks.Config{
+			Token:           "test",
+			Host:            "adb-1234.5.azuredatabricks.net",
+			Port:            443,
+			HTTPath:         "/sql/1.0/warehouses/abc",
+			TableName:       "test",
+			BatchInsertSize: 1,
+		}
+	}
+
+	testCases := []struct {
+		name    string
+		modify  func(*databricks.Config)
+		wantErr []string
+	}{
+		{
+			name:   "valid",
+			modify: func(*databricks.Config) {},
+		},
+		{
+			name:    "token and client credentials",
+			modify:  func(c *databricks.Config) { c.ClientID, c.ClientSecret = "id", "secret" },
+			wantErr: []string{"exactly one authentication method"},
+		},
+		{
+			name:    "host with scheme",
+			modify:  func(c *databricks.Config) { c.Host = "https://adb-1234.5.azuredatabricks.net" },
+			wantErr: []string{"without a scheme"},
+		},
+		{
+			name:    "port out of range",
+			modify:  func(c *databricks.Config) { c.Port = 70000 },
+			wantErr: []string{"port 70000 is out of range"},
+		},
+		{
+			name:    "catalog without table",
+			modify:  func(c *databricks.Config) { c.Catalog = "main" },
+			wantErr: []string{"require table to be set"},
+		},
+		{
+			name:    "no table",
+			modify:  func(c *databricks.Config) { c.TableName = "" },
+			wantErr: []string{"either tableName or table"},
+		},
+		{
+			name:    "batch size not positive",
+			modify:  func(c *databricks.Config) { c.BatchInsertSize = 0 },
+			wantErr: []string{"batchInsertSize needs to be positive"},
+		},
+		{
+			name: "metadata key and template",
+			modify: func(c *databricks.Config) {
+				c.TableMetadataKey = "opencdc.collection"
+				c.TableNameTemplate = "events"
+			},
+			wantErr: []string{"can't be used together"},
+		},
+		{
+			name:    "invalid template",
+			modify:  func(c *databricks.Config) { c.TableNameTemplate = "{{ .Metadata" },
+			wantErr: []string{"invalid tableNameTemplate"},
+		},
+		{
+			name:    "proxy without host",
+			modify:  func(c *databricks.Config) { c.ProxyURL = "http://" },
+			wantErr: []string{"the host is missing"},
+		},
+		{
+			name:    "proxy with unsupported scheme",
+			modify:  func(c *databricks.Config) { c.ProxyURL = "ftp://proxy.example.com" },
+			wantErr: []string{"the scheme needs to be http, https or socks5"},
+		},
+		{
+			name: "proxy with dsn",
+			modify: func(c *databricks.Config) {
+				c.Token, c.Host, c.HTTPath = "", "", ""
+				c.DSN = "token:dapi123@dbc-123.cloud.databricks.com:443/sql/1.0/warehouses/abc"
+				c.ProxyURL = "http://proxy.example.com:3128"
+			},
+			wantErr: []string{"proxyUrl can't be combined with dsn"},
+		},
+		{
+			name:    "copy without staging path",
+			modify:  func(c *databricks.Config) { c.LoadMode = "copy" },
+			wantErr: []string{`loadMode "copy" requires stagingPath to be set`},
+		},
+		{
+			name: "copy with upsert",
+			modify: func(c *databricks.Config) {
+				c.LoadMode, c.StagingPath = "copy", "/Volumes/main/default/staging"
+				c.Upsert = true
+			},
+			wantErr: []string{`loadMode "copy" can't be combined with upsert`},
+		},
+		{
+			name: "column included and excluded",
+			modify: func(c *databricks.Config) {
+				c.IncludeColumns = []string{"id", "name"}
+				c.ExcludeColumns = []string{"Name"}
+			},
+			wantErr: []string{`column "Name" is in both includeColumns and excludeColumns`},
+		},
+		{
+			name: "key column excluded",
+			modify: func(c *databricks.Config) {
+				c.KeyColumns = []string{"id"}
+				c.ExcludeColumns = []string{"id"}
+			},
+			wantErr: []string{`key column "id" can't be in excludeColumns`},
+		},
+		{
+			name: "key column not included",
+			modify: func(c *databricks.Config) {
+				c.KeyColumns = []string{"id"}
+				c.IncludeColumns = []string{"name"}
+			},
+			wantErr: []string{`key column "id" needs to be in includeColumns`},
+		},
+		{
+			name:    "column mapping to invalid column",
+			modify:  func(c *databricks.Config) { c.ColumnMapping = map[string]string{"userId": "user`id"} },
+			wantErr: []string{"invalid columnMapping.userId"},
+		},
+		{
+			name:    "encrypted columns without key",
+			modify:  func(c *databricks.Config) { c.EncryptedColumns = []string{"ssn"} },
+			wantErr: []string{"encryptionKey is required when encryptedColumns is set"},
+		},
+		{
+			name: "encryption key not base64",
+			modify: func(c *databricks.Config) {
+				c.EncryptedColumns = []string{"ssn"}
+				c.EncryptionKey = "not base64!"
+			},
+			wantErr: []string{"invalid encryptionKey, it needs to be base64 encoded"},
+		},
+		{
+			name: "encryption key of invalid length",
+			modify: func(c *databricks.Config) {
+				c.EncryptedColumns = []string{"ssn"}
+				c.EncryptionKey = "MDEyMzQ1Njc4OQ=="
+			},
+			wantErr: []string{"it needs to be 16, 24 or 32 bytes long, got 10"},
+		},
+		{
+			name: "key column encrypted",
+			modify: func(c *databricks.Config) {
+				c.KeyColumns = []string{"id", "ssn"}
+				c.EncryptedColumns = []string{"SSN"}
+				c.EncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZg=="
+			},
+			wantErr: []string{`key column "ssn" can't be in encryptedColumns`},
+		},
+		{
+			name:    "unknown log field",
+			modify:  func(c *databricks.Config) { c.LogFields = []string{"foo"} },
+			wantErr: []string{"unknown log field"},
+		},
+		{
+			name: "several errors",
+			modify: func(c *databricks.Config) {
+				c.Host = "https://adb-1234.5.azuredatabricks.net"
+				c.Port = 0
+				c.TableName = ""
+			},
+			wantErr: []string{"without a scheme", "port 0 is out of range", "either tableName or table"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			cfg := valid()
+			tc.modify(&cfg)
+			err := cfg.Validate()
+			if len(tc.wantErr) == 0 {
+				is.NoErr(err)
+				return
+			}
+			is.True(err != nil)
+			for _, want := range tc.wantErr {
+				is.True(strings.Contains(err.Error(), want)) // error mentions every violated rule
+			}
+		})
+	}
+}
+
+func TestWrite_PerRecordTimeout(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := mock.NewClient(gomock.NewController(t))
+
+	underTest := databricks.NewDestinationWithClient(client)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":            "test",
+		"host":             "test",
+		"httpPath":         "test",
+		"tableName":        "test",
+		"perRecordTimeout": "50ms",
+	})
+	is.NoErr(err)
+
+	records := []opencdc.Record{
+		{Position: opencdc.Position("fast"), Operation: opencdc.OperationCreate},
+		{Position: opencdc.Position("slow"), Operation: opencdc.OperationCreate},
+	}
+	client.EXPECT().Insert(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, r opencdc.Record) error {
+			if string(r.Position) == "fast" {
+				_, ok := ctx.Deadline()
+				is.True(ok) // expected a deadline on the record context
+				return nil
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	).Times(2)
+
+	n, err := underTest.Write(ctx, records)
+	is.Equal(1, n)
+	is.True(errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestWrite_UnspecifiedOperation(t *testing.T) {
+	testCases := []struct {
+		name    string
+		mode    string
+		wantErr error
+	}{
+		{name: "reject", mode: "reject", wantErr: databricks.ErrUnknownOperation},
+		{name: "create", mode: "create"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			ctx := context.Background()
+			client := mock.NewClient(gomock.NewController(t))
+
+			underTest := databricks.NewDestinationWithClient(client)
+			err := underTest.Configure(ctx, map[string]string{
+				"token":                "test",
+				"host":                 "test",
+				"httpPath":             "test",
+				"tableName":            "test",
+				"unspecifiedOperation": tc.mode,
+			})
+			is.NoErr(err)
+
+			// no operation set
+			rec := opencdc.Record{Position: opencdc.Position("test-pos")}
+			if tc.wantErr == nil {
+				client.EXPECT().Insert(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, r opencdc.Record) error {
+						is.Equal(opencdc.OperationCreate, r.Operation)
+						return nil
+					},
+				)
+			}
+
+			n, err := underTest.Write(ctx, []opencdc.Record{rec})
+			if tc.wantErr != nil {
+				is.Equal(0, n)
+				is.True(errors.Is(err, tc.wantErr))
+				return
+			}
+			is.NoErr(err)
+			is.Equal(1, n)
+		})
+	}
+}
+
+func TestWrite_ContextCancelled(t *testing.T) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := mock.NewClient(gomock.NewController(t))
+
+	underTest := databricks.NewDestinationWithClient(client)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":     "test",
+		"host":      "test",
+		"httpPath":  "test",
+		"tableName": "test",
+	})
+	is.NoErr(err)
+
+	// the pipeline shuts down while the second record is being written
+	gomock.InOrder(
+		client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil),
+		client.EXPECT().Insert(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(context.Context, opencdc.Record) error {
+				cancel()
+				return nil
+			},
+		),
+	)
+
+	records := []opencdc.Record{
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-1")},
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-2")},
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-3")},
+	}
+	n, err := underTest.Write(ctx, records)
+	is.Equal(2, n)
+	is.True(errors.Is(err, context.Canceled))
+}
+
+func TestWrite_BatchInsert(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := mock.NewClient(gomock.NewController(t))
+
+	underTest := databricks.NewDestinationWithClient(client)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":           "test",
+		"host":            "test",
+		"httpPath":        "test",
+		"tableName":       "test",
+		"batchInsertSize": "2",
+	})
+	is.NoErr(err)
+
+	records := []opencdc.Record{
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-1")},
+		{Operation: opencdc.OperationSnapshot, Position: opencdc.Position("pos-2")},
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-3")},
+		{Operation: opencdc.OperationUpdate, Position: opencdc.Position("pos-4")},
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-5")},
+	}
+	gomock.InOrder(
+		client.EXPECT().InsertBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, batch []opencdc.Record) error {
+				is.Equal(2, len(batch))
+				is.Equal(opencdc.Position("pos-1"), batch[0].Position)
+				is.Equal(opencdc.Position("pos-2"), batch[1].Position)
+				is.Equal(opencdc.OperationCreate, batch[1].Operation)
+				return nil
+			},
+		),
+		client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil),
+		client.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil),
+		client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(errors.New("boom")),
+	)
+
+	n, err := underTest.Write(ctx, records)
+	is.True(err != nil)
+	is.Equal(4, n)
+}
+
+func TestWrite_CopyInto(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := mock.NewClient(gomock.NewController(t))
+
+	underTest := databricks.NewDestinationWithClient(client)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":       "test",
+		"host":        "test",
+		"httpPath":    "test",
+		"tableName":   "test",
+		"loadMode":    "copy",
+		"stagingPath": "/Volumes/main/default/staging",
+	})
+	is.NoErr(err)
+
+	// runs of inserts are loaded with COPY INTO, regardless of batchInsertSize
+	records := []opencdc.Record{
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-1")},
+		{Operation: opencdc.OperationSnapshot, Position: opencdc.Position("pos-2")},
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-3")},
+		{Operation: opencdc.OperationDelete, Position: opencdc.Position("pos-4")},
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-5")},
+	}
+	gomock.InOrder(
+		client.EXPECT().CopyInto(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, batch []opencdc.Record) error {
+				is.Equal(3, len(batch))
+				is.Equal(opencdc.Position("pos-3"), batch[2].Position)
+				return nil
+			},
+		),
+		client.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil),
+		client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil),
+	)
+
+	n, err := underTest.Write(ctx, records)
+	is.NoErr(err)
+	is.Equal(5, n)
+}
+
+// runStream is the stream through which Conduit sends records
+// to the destination, and the destination acknowledges them.
+type runStream struct {
+	requests chan pconnector.DestinationRunRequest
+	acks     chan []pconnector.DestinationRunResponseAck
+}
+
+func (s *runStream) Client() pconnector.DestinationRunStreamClient { return nil }
+func (s *runStream) Server() pconnector.DestinationRunStreamServer { return s }
+
+func (s *runStream) Recv() (pconnector.DestinationRunRequest, error) {
+	req, ok := <-s.requests
+	if !ok {
+		return pconnector.DestinationRunRequest{}, io.EOF
+	}
+	return req, nil
+}
+
+func (s *runStream) Send(resp pconnector.DestinationRunResponse) error {
+	s.acks <- resp.Acks
+	return nil
+}
+
+// send sends records to the destination one at a time.
+func (s *runStream) send(positions ...string) {
+	for _, pos := range positions {
+		s.requests <- pconnector.DestinationRunRequest{Records: []opencdc.Record{
+			{Operation: opencdc.OperationCreate, Position: opencdc.Position(pos)},
+		}}
+	}
+}
+
+// expectAcks expects the records with the given positions
+// to be acknowledged at once.
+func (s *runStream) expectAcks(is *is.I, positions ...string) {
+	select {
+	case acks := <-s.acks:
+		is.Equal(len(positions), len(acks))
+		for i, pos := range positions {
+			is.Equal(opencdc.Position(pos), acks[i].Position)
+			is.Equal("", acks[i].Error)
+		}
+	case <-time.After(5 * time.Second):
+		is.Fail() // records weren't acknowledged
+	}
+}
+
+// runDestination runs the destination as the SDK does in a pipeline,
+// and returns the plugin and the stream through which records are sent.
+func runDestination(t *testing.T, client *mock.Client, cfg map[string]string) (pconnector.DestinationPlugin, *runStream) {
+	is := is.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	plugin := sdk.NewDestinationPlugin(databricks.NewDestinationWithClient(client), pconnector.PluginConfig{})
+	_, err := plugin.Configure(ctx, pconnector.DestinationConfigureRequest{Config: cfg})
+	is.NoErr(err)
+	client.EXPECT().Open(gomock.Any(), gomock.Any()).Return(nil)
+	_, err = plugin.Open(ctx, pconnector.DestinationOpenRequest{})
+	is.NoErr(err)
+
+	stream := &runStream{
+		requests: make(chan pconnector.DestinationRunRequest),
+		acks:     make(chan []pconnector.DestinationRunResponseAck, 10),
+	}
+	go func() {
+		_ = plugin.Run(ctx, stream)
+	}()
+	t.Cleanup(func() { close(stream.requests) })
+
+	return plugin, stream
+}
+
+// expectBatch expects the records with the given positions to be
+// inserted with a single statement.
+func expectBatch(is *is.I, client *mock.Client, positions ...string) {
+	client.EXPECT().InsertBatch(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, batch []opencdc.Record) error {
+			is.Equal(len(positions), len(batch))
+			for i, pos := range positions {
+				is.Equal(opencdc.Position(pos), batch[i].Position)
+			}
+			return nil
+		},
+	)
+}
+
+func TestWrite_Buffered_Size(t *testing.T) {
+	is := is.New(t)
+	client := mock.NewClient(gomock.NewController(t))
+	_, stream := runDestination(t, client, map[string]string{
+		"token":           "test",
+		"host":            "test",
+		"httpPath":        "test",
+		"tableName":       "test",
+		"batchInsertSize": "100",
+		"sdk.batch.size":  "3",
+	})
+
+	// records are only written, and acknowledged, once three arrived
+	expectBatch(is, client, "pos-1", "pos-2", "pos-3")
+	stream.send("pos-1", "pos-2")
+	select {
+	case <-stream.acks:
+		is.Fail() // acknowledged before the batch was full
+	case <-time.After(50 * time.Millisecond):
+	}
+	stream.send("pos-3")
+	stream.expectAcks(is, "pos-1", "pos-2", "pos-3")
+}
+
+func TestWrite_Buffered_Delay(t *testing.T) {
+	is := is.New(t)
+	client := mock.NewClient(gomock.NewController(t))
+	_, stream := runDestination(t, client, map[string]string{
+		"token":           "test",
+		"host":            "test",
+		"httpPath":        "test",
+		"tableName":       "test",
+		"batchInsertSize": "100",
+		"sdk.batch.size":  "100",
+		"sdk.batch.delay": "20ms",
+	})
+
+	expectBatch(is, client, "pos-1", "pos-2")
+	stream.send("pos-1", "pos-2")
+	stream.expectAcks(is, "pos-1", "pos-2")
+}
+
+func TestWrite_Buffered_FlushOnStop(t *testing.T) {
+	is := is.New(t)
+	client := mock.NewClient(gomock.NewController(t))
+	plugin, stream := runDestination(t, client, map[string]string{
+		"token":           "test",
+		"host":            "test",
+		"httpPath":        "test",
+		"tableName":       "test",
+		"batchInsertSize": "100",
+		"sdk.batch.size":  "100",
+	})
+
+	// records still buffered are written when the destination stops
+	expectBatch(is, client, "pos-1", "pos-2")
+	stream.send("pos-1", "pos-2")
+	_, err := plugin.Stop(context.Background(), pconnector.DestinationStopRequest{LastPosition: opencdc.Position("pos-2")})
+	is.NoErr(err)
+	stream.expectAcks(is, "pos-1", "pos-2")
+
+	client.EXPECT().Close().Return(nil)
+	_, err = plugin.Teardown(context.Background(), pconnector.DestinationTeardownRequest{})
+	is.NoErr(err)
+}
+
+func TestWrite_BatchInsert_RoutedTables(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := mock.NewClient(gomock.NewController(t))
+
+	underTest := databricks.NewDestinationWithClient(client)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":            "test",
+		"host":             "test",
+		"httpPath":         "test",
+		"tableName":        "test",
+		"batchInsertSize":  "3",
+		"tableMetadataKey": "opencdc.collection",
+	})
+	is.NoErr(err)
+
+	records := []opencdc.Record{
+		{Operation: opencdc.OperationCreate, Metadata: opencdc.Metadata{"opencdc.collection": "orders"}},
+		{Operation: opencdc.OperationCreate, Metadata: opencdc.Metadata{"opencdc.collection": "orders"}},
+		{Operation: opencdc.OperationCreate, Metadata: opencdc.Metadata{"opencdc.collection": "customers"}},
+	}
+	gomock.InOrder(
+		client.EXPECT().InsertBatch(gomock.Any(), gomock.Len(2)).Return(nil),
+		client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil),
+	)
+
+	n, err := underTest.Write(ctx, records)
+	is.NoErr(err)
+	is.Equal(3, n)
+}
+
+func TestWrite_TableNameTemplate(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := mock.NewClient(gomock.NewController(t))
+
+	underTest := databricks.NewDestinationWithClient(client)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":             "test",
+		"host":              "test",
+		"httpPath":          "test",
+		"tableName":         "test",
+		"batchInsertSize":   "3",
+		"tableNameTemplate": `events_{{ index .Metadata "region" }}`,
+	})
+	is.NoErr(err)
+
+	records := []opencdc.Record{
+		{Operation: opencdc.OperationCreate, Metadata: opencdc.Metadata{"region": "eu"}},
+		{Operation: opencdc.OperationCreate, Metadata: opencdc.Metadata{"region": "eu"}},
+		{Operation: opencdc.OperationCreate, Metadata: opencdc.Metadata{"region": "us"}},
+	}
+	gomock.InOrder(
+		client.EXPECT().InsertBatch(gomock.Any(), gomock.Len(2)).Return(nil),
+		client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil),
+	)
+
+	n, err := underTest.Write(ctx, records)
+	is.NoErr(err)
+	is.Equal(3, n)
+}
+
+func TestConfigure_InvalidTableNameTemplate(t *testing.T) {
+	is := is.New(t)
+
+	underTest := databricks.NewDestinationWithClient(mock.NewClient(gomock.NewController(t)))
+	err := underTest.Configure(context.Background(), map[string]string{
+		"token":             "test",
+		"host":              "test",
+		"httpPath":          "test",
+		"tableName":         "test",
+		"tableNameTemplate": `events_{{ index .Metadata "region" }`,
+	})
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "invalid tableNameTemplate"))
+}
+
+func TestWrite_Upsert(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := mock.NewClient(gomock.NewController(t))
+
+	underTest := databricks.NewDestinationWithClient(client)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":           "test",
+		"host":            "test",
+		"httpPath":        "test",
+		"tableName":       "test",
+		"upsert":          "true",
+		"batchInsertSize": "10",
+	})
+	is.NoErr(err)
+
+	// creates and snapshots are upserted one by one, even with batching enabled
+	client.EXPECT().Upsert(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	client.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+
+	n, err := underTest.Write(ctx, []opencdc.Record{
+		{Operation: opencdc.OperationCreate},
+		{Operation: opencdc.OperationSnapshot},
+		{Operation: opencdc.OperationUpdate},
+	})
+	is.NoErr(err)
+	is.Equal(3, n)
+}
+
+type resultsRecorder struct {
+	results []databricks.WriteResults
+}
+
+func (r *resultsRecorder) OnWrite(_ context.Context, results databricks.WriteResults) {
+	r.results = append(r.results, results)
+}
+
+func TestWrite_ResultsCallback(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := mock.NewClient(gomock.NewController(t))
+	recorder := &resultsRecorder{}
+
+	underTest := databricks.NewDestinationWithResultsCallback(client, recorder)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":     "test",
+		"host":      "test",
+		"httpPath":  "test",
+		"tableName": "test",
+	})
+	is.NoErr(err)
+
+	client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil).Times(3)
+	client.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+	client.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil)
+
+	records := []opencdc.Record{
+		{Operation: opencdc.OperationSnapshot, Position: opencdc.Position("pos-1")},
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-2")},
+		{Operation: opencdc.OperationUpdate, Position: opencdc.Position("pos-3")},
+		{Operation: opencdc.OperationDelete, Position: opencdc.Position("pos-4")},
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-5")},
+	}
+	n, err := underTest.Write(ctx, records)
+	is.NoErr(err)
+	is.Equal(5, n)
+
+	// a failed batch reports the records written before the failure
+	wantErr := errors.New("boom")
+	client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil)
+	client.EXPECT().Update(gomock.Any(), gomock.Any()).Return(wantErr)
+	_, err = underTest.Write(ctx, records[1:3])
+	is.True(errors.Is(err, wantErr))
+
+	is.Equal(2, len(recorder.results))
+	is.Equal(databricks.WriteResults{
+		Inserted:     3,
+		Updated:      1,
+		Deleted:      1,
+		LastPosition: opencdc.Position("pos-5"),
+	}, recorder.results[0])
+	is.Equal(1, recorder.results[1].Inserted)
+	is.Equal(0, recorder.results[1].Updated)
+	is.Equal(opencdc.Position("pos-2"), recorder.results[1].LastPosition)
+	is.True(errors.Is(recorder.results[1].Err, wantErr))
+}
+
+func TestWrite_Metrics(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := mock.NewClient(gomock.NewController(t))
+	metrics := databricks.NewMetrics()
+
+	underTest := databricks.NewDestinationWithMetrics(client, metrics)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":     "test",
+		"host":      "test",
+		"httpPath":  "test",
+		"tableName": "test",
+	})
+	is.NoErr(err)
+
+	client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	client.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+	client.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil)
+
+	records := []opencdc.Record{
+		{Operation: opencdc.OperationCreate, Key: opencdc.RawData(`{"id":1}`), Payload: opencdc.Change{After: opencdc.RawData(`{"name":"a"}`)}},
+		{Operation: opencdc.OperationSnapshot, Key: opencdc.RawData(`{"id":2}`), Payload: opencdc.Change{After: opencdc.RawData(`{"name":"b"}`)}},
+		{Operation: opencdc.OperationUpdate, Key: opencdc.RawData(`{"id":1}`), Payload: opencdc.Change{After: opencdc.RawData(`{"name":"c"}`)}},
+		{Operation: opencdc.OperationDelete, Key: opencdc.RawData(`{"id":2}`)},
+	}
+	_, err = underTest.Write(ctx, records)
+	is.NoErr(err)
+
+	client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(errors.New("boom"))
+	_, err = underTest.Write(ctx, records[:1])
+	is.True(err != nil)
+
+	got := metrics.Snapshot()
+	is.Equal(int64(2), got.Inserted)
+	is.Equal(int64(1), got.Updated)
+	is.Equal(int64(1), got.Deleted)
+	is.Equal(int64(1), got.Failed)
+	is.Equal(int64(4*8+3*12), got.Bytes) // keys and payloads of the written records
+	is.Equal(int64(2), got.WriteLatency.Count)
+	var counted int64
+	for _, c := range got.WriteLatency.Counts {
+		counted += c
+	}
+	is.Equal(int64(2), counted)
+}
+
+func TestWrite_ReadBack(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := mock.NewClient(gomock.NewController(t))
+	recorder := &resultsRecorder{}
+
+	underTest := databricks.NewDestinationWithResultsCallback(client, recorder)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":           "test",
+		"host":            "test",
+		"httpPath":        "test",
+		"tableName":       "test",
+		"readBackColumns": "row_id",
+	})
+	is.NoErr(err)
+
+	client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	client.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil)
+	// only inserted rows are read back, a failed read back doesn't fail the write
+	client.EXPECT().ReadBack(gomock.Any(), gomock.Any()).Return(opencdc.StructuredData{"row_id": int64(42)}, nil)
+	client.EXPECT().ReadBack(gomock.Any(), gomock.Any()).Return(nil, errors.New("boom"))
+
+	n, err := underTest.Write(ctx, []opencdc.Record{
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-1")},
+		{Operation: opencdc.OperationUpdate, Position: opencdc.Position("pos-2")},
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-3")},
+	})
+	is.NoErr(err)
+	is.Equal(3, n)
+
+	is.Equal(1, len(recorder.results))
+	is.Equal([]databricks.ReadBackValues{{
+		Position: opencdc.Position("pos-1"),
+		Values:   opencdc.StructuredData{"row_id": int64(42)},
+	}}, recorder.results[0].ReadBack)
+}
+
+func TestWrite_OnError(t *testing.T) {
+	testCases := []struct {
+		onError string
+		wantErr bool
+	}{
+		{onError: "abort", wantErr: true},
+		{onError: "skip"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.onError, func(t *testing.T) {
+			is := is.New(t)
+			ctx := context.Background()
+			client := mock.NewClient(gomock.NewController(t))
+			recorder := &resultsRecorder{}
+
+			underTest := databricks.NewDestinationWithResultsCallback(client, recorder)
+			err := underTest.Configure(ctx, map[string]string{
+				"token":     "test",
+				"host":      "test",
+				"httpPath":  "test",
+				"tableName": "test",
+				"onError":   tc.onError,
+			})
+			is.NoErr(err)
+
+			poison := errors.New("[UNRESOLVED_COLUMN.WITH_SUGGESTION] A column cannot be resolved")
+			client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(poison)
+			if !tc.wantErr {
+				client.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil)
+			}
+
+			records := []opencdc.Record{
+				{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-1"), Key: opencdc.RawData(`{"id":1}`)},
+				{Operation: opencdc.OperationDelete, Position: opencdc.Position("pos-2"), Key: opencdc.RawData(`{"id":2}`)},
+			}
+			n, err := underTest.Write(ctx, records)
+			if tc.wantErr {
+				is.True(errors.Is(err, poison))
+				is.Equal(0, n)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(2, n)
+
+			// the poison record doesn't block the rest of the batch
+			results := recorder.results[0]
+			is.Equal(1, results.Deleted)
+			is.Equal(1, len(results.DeadLettered))
+			is.Equal(records[0], results.DeadLettered[0].Record)
+			is.True(errors.Is(results.DeadLettered[0].Err, poison))
+			is.Equal(opencdc.Position("pos-2"), results.LastPosition)
+		})
+	}
+}
+
+func TestWrite_OnError_SkipBatch(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := mock.NewClient(gomock.NewController(t))
+	recorder := &resultsRecorder{}
+
+	underTest := databricks.NewDestinationWithResultsCallback(client, recorder)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":           "test",
+		"host":            "test",
+		"httpPath":        "test",
+		"tableName":       "test",
+		"batchInsertSize": "3",
+		"onError":         "skip",
+	})
+	is.NoErr(err)
+
+	poison := errors.New("[DATATYPE_MISMATCH] cannot cast")
+	// the failed batch is retried record by record, skipping the failing one
+	client.EXPECT().InsertBatch(gomock.Any(), gomock.Len(3)).Return(poison)
+	client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil)
+	client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(poison)
+	client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil)
+
+	records := []opencdc.Record{
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-1")},
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-2")},
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-3")},
+	}
+	n, err := underTest.Write(ctx, records)
+	is.NoErr(err)
+	is.Equal(3, n)
+
+	results := recorder.results[0]
+	is.Equal(2, results.Inserted)
+	is.Equal(1, len(results.DeadLettered))
+	is.Equal(records[1], results.DeadLettered[0].Record)
+}
+
+func TestWrite_CopyInto_AnsiCastRetry(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+	client := mock.NewClient(gomock.NewController(t))
+
+	underTest := databricks.NewDestinationWithClient(client)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":         "test",
+		"host":          "test",
+		"httpPath":      "test",
+		"tableName":     "test",
+		"loadMode":      "copy",
+		"stagingPath":   "/Volumes/main/default/staging",
+		"ansiCastRetry": "true",
+	})
+	is.NoErr(err)
+
+	// the records of a batch failing because of a cast are written one by
+	// one, which retries them with explicit casts
+	castErr := errors.New("[DATATYPE_MISMATCH.CAST_WITHOUT_SUGGESTION] cannot cast \"STRING\" to \"INT\"")
+	gomock.InOrder(
+		client.EXPECT().CopyInto(gomock.Any(), gomock.Len(2)).Return(castErr),
+		client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil).Times(2),
+	)
+
+	n, err := underTest.Write(ctx, []opencdc.Record{
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-1")},
+		{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-2")},
+	})
+	is.NoErr(err)
+	is.Equal(2, n)
+}
+
+func TestWrite_BatchPartiallyWritten(t *testing.T) {
+	testCases := []struct {
+		onError string
+		wantN   int
+		wantErr bool
+	}{
+		{onError: "abort", wantN: 1, wantErr: true},
+		{onError: "skip", wantN: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.onError, func(t *testing.T) {
+			is := is.New(t)
+			ctx := context.Background()
+			client := mock.NewClient(gomock.NewController(t))
+			recorder := &resultsRecorder{}
+
+			underTest := databricks.NewDestinationWithResultsCallback(client, recorder)
+			err := underTest.Configure(ctx, map[string]string{
+				"token":           "test",
+				"host":            "test",
+				"httpPath":        "test",
+				"tableName":       "test",
+				"batchInsertSize": "3",
+				"onError":         tc.onError,
+			})
+			is.NoErr(err)
+
+			poison := errors.New("[DATATYPE_MISMATCH] cannot cast")
+			// the first record has been inserted before the batch failed,
+			// so only the records after it are written one by one
+			client.EXPECT().InsertBatch(gomock.Any(), gomock.Len(3)).
+				Return(&databricks.BatchError{Written: 1, Err: poison})
+			if tc.onError == "skip" {
+				var inserted []opencdc.Position
+				client.EXPECT().Insert(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, r opencdc.Record) error {
+						inserted = append(inserted, r.Position)
+						return nil
+					},
+				).Times(2)
+				defer func() {
+					is.Equal([]opencdc.Position{opencdc.Position("pos-2"), opencdc.Position("pos-3")}, inserted)
+				}()
+			}
+
+			records := []opencdc.Record{
+				{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-1")},
+				{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-2")},
+				{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-3")},
+			}
+			n, err := underTest.Write(ctx, records)
+			is.Equal(tc.wantErr, err != nil)
+			is.Equal(tc.wantN, n)
+			is.Equal(tc.wantN, recorder.results[0].Inserted)
+		})
+	}
+}
+
+func TestWrite_TypeMismatch(t *testing.T) {
+	testCases := []struct {
+		policy         string
+		wantErr        bool
+		wantDeadLetter bool
+	}{
+		{policy: "error", wantErr: true},
+		{policy: "skip"},
+		{policy: "deadletter", wantDeadLetter: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			is := is.New(t)
+			ctx := context.Background()
+			client := mock.NewClient(gomock.NewController(t))
+			recorder := &resultsRecorder{}
+
+			underTest := databricks.NewDestinationWithResultsCallback(client, recorder)
+			err := underTest.Configure(ctx, map[string]string{
+				"token":        "test",
+				"host":         "test",
+				"httpPath":     "test",
+				"tableName":    "test",
+				"typeMismatch": tc.policy,
+			})
+			is.NoErr(err)
+
+			mismatch := fmt.Errorf("%w: column \"quantity\" of type int can't hold string value many", databricks.ErrTypeMismatch)
+			client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil)
+			client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(mismatch)
+			if !tc.wantErr {
+				client.EXPECT().Insert(gomock.Any(), gomock.Any()).Return(nil)
+			}
+
+			records := []opencdc.Record{
+				{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-1")},
+				{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-2")},
+				{Operation: opencdc.OperationCreate, Position: opencdc.Position("pos-3")},
+			}
+			n, err := underTest.Write(ctx, records)
+			if tc.wantErr {
+				is.True(errors.Is(err, databricks.ErrTypeMismatch))
+				is.Equal(1, n)
+				return
+			}
+			is.NoErr(err)
+			is.Equal(3, n)
+
+			results := recorder.results[0]
+			is.Equal(2, results.Inserted)
+			if tc.wantDeadLetter {
+				is.Equal(1, len(results.DeadLettered))
+				is.Equal(records[1], results.DeadLettered[0].Record)
+				is.True(errors.Is(results.DeadLettered[0].Err, databricks.ErrTypeMismatch))
+			} else {
+				is.Equal(0, len(results.DeadLettered))
+			}
+		})
+	}
+}
+
+func TestWrite_LogFields(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	ctx := logger.WithContext(context.Background())
+	client := mock.NewClient(gomock.NewController(t))
+
+	underTest := databricks.NewDestinationWithClient(client)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":     "test",
+		"host":      "test",
+		"httpPath":  "test",
+		"tableName": "products",
+	})
+	is.NoErr(err)
+
+	client.EXPECT().Delete(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _ opencdc.Record) error {
+			sdk.Logger(ctx).Info().Msg("deleting")
+			return nil
+		},
+	)
+	_, err = underTest.Write(ctx, []opencdc.Record{{Operation: opencdc.OperationDelete}})
+	is.NoErr(err)
+
+	var line map[string]interface{}
+	for _, l := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		line = nil
+		is.NoErr(json.Unmarshal(l, &line))
+		if line["message"] == "deleting" {
+			break
+		}
+	}
+	is.Equal("deleting", line["message"])
+	is.Equal("products", line["table"])
+	is.Equal("delete", line["operation"])
+	_, ok := line["connector_id"]
+	is.True(ok)
+}
+
+func TestWrite_LogFields_RoutedTable(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	ctx := logger.WithContext(context.Background())
+	client := mock.NewClient(gomock.NewController(t))
+
+	underTest := databricks.NewDestinationWithClient(client)
+	err := underTest.Configure(ctx, map[string]string{
+		"token":            "test",
+		"host":             "test",
+		"httpPath":         "test",
+		"tableName":        "products",
+		"tableMetadataKey": "opencdc.collection",
+	})
+	is.NoErr(err)
+
+	client.EXPECT().Delete(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, _ opencdc.Record) error {
+			sdk.Logger(ctx).Info().Msg("deleting")
+			return nil
+		},
+	).Times(2)
+	_, err = underTest.Write(ctx, []opencdc.Record{
+		{Operation: opencdc.OperationDelete, Metadata: opencdc.Metadata{"opencdc.collection": "orders"}},
+		{Operation: opencdc.OperationDelete},
+	})
+	is.NoErr(err)
+
+	var tables []interface{}
+	for _, l := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var line map[string]interface{}
+		is.NoErr(json.Unmarshal(l, &line))
+		if line["message"] == "deleting" {
+			tables = append(tables, line["table"])
+		}
+	}
+	// the table field holds the table each record is written to
+	is.Equal([]interface{}{"orders", "products"}, tables)
+}
+
+func TestConfigure_UnknownLogField(t *testing.T) {
+	is := is.New(t)
+
+	underTest := databricks.NewDestinationWithClient(mock.NewClient(gomock.NewController(t)))
+	err := underTest.Configure(context.Background(), map[string]string{
+		"token":     "test",
+		"host":      "test",
+		"httpPath":  "test",
+		"tableName": "products",
+		"logFields": "table,pipeline",
+	})
+	is.True(err != nil)
+}
+
 func TestTeardown_NoOpen(t *testing.T) {
 	con := databricks.NewDestination()
 	err := con.Teardown(context.Background())
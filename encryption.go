@@ -0,0 +1,151 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Encryptor transforms values of sensitive columns before they are
+// written, e.g. by encrypting or tokenizing them.
+type Encryptor interface {
+	// Encrypt returns the representation of value to be written.
+	Encrypt(value interface{}) (interface{}, error)
+}
+
+// NoopEncryptor writes values as they are.
+type NoopEncryptor struct{}
+
+func (NoopEncryptor) Encrypt(value interface{}) (interface{}, error) {
+	return value, nil
+}
+
+// AESEncryptor encrypts values with AES-GCM. Values are written as base64
+// strings holding the nonce followed by the ciphertext. Since every value is
+// encrypted with a random nonce, equal values produce different ciphertexts,
+// so key columns must not be encrypted.
+type AESEncryptor struct {
+	aead cipher.AEAD
+}
+
+// NewAESEncryptor creates an AESEncryptor. The key needs to be
+// 16, 24 or 32 bytes long, to select AES-128, AES-192 or AES-256.
+func NewAESEncryptor(key []byte) (*AESEncryptor, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating GCM: %w", err)
+	}
+
+	return &AESEncryptor{aead: aead}, nil
+}
+
+func (e *AESEncryptor) Encrypt(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	var plaintext []byte
+	switch v := value.(type) {
+	case string:
+		plaintext = []byte(v)
+	case []byte:
+		plaintext = v
+	default:
+		var err error
+		plaintext, err = json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed marshalling value: %w", err)
+		}
+	}
+
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed generating nonce: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(e.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// validateEncryption checks that encryptionKey is a valid AES key, if
+// encryptedColumns is set, and that no key column is encrypted, since
+// the random nonce makes an encrypted key never match the written row.
+func (c Config) validateEncryption() error {
+	if len(c.EncryptedColumns) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, col := range c.KeyColumns {
+		if containsFold(c.EncryptedColumns, col) {
+			errs = append(errs, fmt.Errorf("key column %q can't be in %v", col, ConfigEncryptedColumns))
+		}
+	}
+
+	if c.EncryptionKey == "" {
+		return errors.Join(append(errs, fmt.Errorf("%v is required when %v is set", ConfigEncryptionKey, ConfigEncryptedColumns))...)
+	}
+	key, err := base64.StdEncoding.DecodeString(c.EncryptionKey)
+	if err != nil {
+		return errors.Join(append(errs, fmt.Errorf("invalid %v, it needs to be base64 encoded: %w", ConfigEncryptionKey, err))...)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		errs = append(errs, fmt.Errorf("invalid %v, it needs to be 16, 24 or 32 bytes long, got %d", ConfigEncryptionKey, len(key)))
+	}
+
+	return errors.Join(errs...)
+}
+
+// openEncryptors registers an AESEncryptor for the configured encrypted
+// columns, which don't have an encryptor registered already.
+func (c *sqlClient) openEncryptors() error {
+	if len(c.config.EncryptedColumns) == 0 {
+		return nil
+	}
+
+	// the key has been checked by Config.Validate
+	key, err := base64.StdEncoding.DecodeString(c.config.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed decoding %v: %w", ConfigEncryptionKey, err)
+	}
+	encryptor, err := NewAESEncryptor(key)
+	if err != nil {
+		return err
+	}
+
+	encryptors := make(map[string]Encryptor, len(c.encryptors)+len(c.config.EncryptedColumns))
+	for col, e := range c.encryptors {
+		encryptors[col] = e
+	}
+	for _, col := range c.config.EncryptedColumns {
+		if _, ok := encryptors[col]; !ok {
+			encryptors[col] = encryptor
+		}
+	}
+	c.encryptors = encryptors
+
+	return nil
+}
@@ -0,0 +1,231 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrPermissionDenied is returned when Databricks rejects a statement because
+// the user lacks the required privileges. Retrying such a statement won't help.
+var ErrPermissionDenied = errors.New("permission denied")
+
+// ErrQueryTimeout is returned when a statement doesn't complete within the
+// configured query timeout. Unlike permanent failures, it may succeed when
+// retried, e.g. once a cold warehouse has started.
+var ErrQueryTimeout = errors.New("query timed out")
+
+// ErrTooManyColumns is returned for records which have more columns
+// than the configured maximum.
+var ErrTooManyColumns = errors.New("too many columns")
+
+// ErrNoKeyForDelete is returned for delete records without a key,
+// since there is no way to tell which row needs to be deleted.
+var ErrNoKeyForDelete = errors.New("delete record has no key")
+
+// ErrTypeMismatch is returned for values which can't be written
+// to their column, because they don't match its type.
+var ErrTypeMismatch = errors.New("value doesn't match column type")
+
+// ErrColumnCollision is returned for records with several fields which
+// map to the same column after their names are normalized.
+var ErrColumnCollision = errors.New("fields collide after normalization")
+
+// ErrInvalidIdentifier is returned for table and column names which can't
+// be used safely in a statement, e.g. a column name containing a backtick.
+var ErrInvalidIdentifier = errors.New("invalid identifier")
+
+// ErrTemporaryView is returned when the table is a temporary view. Temporary
+// views are scoped to a session, so writes through a connection pool can land
+// in different sessions.
+var ErrTemporaryView = errors.New("table is a temporary view")
+
+// BatchError is returned for a batch of records which failed after some of
+// them have been written. The written records are at the start of the
+// batch, so only the records after them need to be written again.
+type BatchError struct {
+	// Written is the number of records which have been written.
+	Written int
+	Err     error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch failed after %v records were written: %v", e.Written, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// writtenBefore returns the number of records of a batch
+// which have been written before it failed with err.
+func writtenBefore(err error) int {
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Written
+	}
+	return 0
+}
+
+// ErrWarehouseStopped is returned when the warehouse isn't running
+// and starting it automatically is not allowed.
+var ErrWarehouseStopped = errors.New("warehouse is stopped")
+
+// ErrChangeDataFeedDisabled is returned when the source reads the change
+// data feed of a table which doesn't have it enabled.
+var ErrChangeDataFeedDisabled = errors.New("change data feed is not enabled")
+
+// permissionDeniedMarkers are substrings of Databricks error messages
+// returned for missing privileges.
+var permissionDeniedMarkers = []string{
+	"PERMISSION_DENIED",
+	"INSUFFICIENT_PERMISSIONS",
+	"does not have permission",
+	"does not have MODIFY",
+	"does not have SELECT",
+	"does not have USE",
+}
+
+// schemaErrorMarkers are substrings of Databricks error messages returned
+// when a statement doesn't match the current table schema.
+var schemaErrorMarkers = []string{
+	"UNRESOLVED_COLUMN",
+	"INSERT_COLUMN_ARITY_MISMATCH",
+	"DELTA_SCHEMA_CHANGED",
+}
+
+// tableNotFoundMarkers are substrings of Databricks error messages
+// returned when the table doesn't exist.
+var tableNotFoundMarkers = []string{
+	"TABLE_OR_VIEW_NOT_FOUND",
+}
+
+// castErrorMarkers are substrings of Databricks error messages returned
+// when a value can't be cast implicitly to the column type in ANSI mode.
+var castErrorMarkers = []string{
+	"CANNOT_SAFELY_CAST",
+	"DATATYPE_MISMATCH",
+}
+
+// connectionErrorMarkers are substrings of errors returned
+// when the connection to the warehouse broke.
+var connectionErrorMarkers = []string{
+	"broken pipe",
+	"connection reset by peer",
+	"unexpected EOF",
+}
+
+// warehouseUnavailableMarkers are substrings of errors returned
+// while a warehouse is stopped or still starting.
+var warehouseUnavailableMarkers = []string{
+	"TEMPORARILY_UNAVAILABLE",
+	"503 Service Unavailable",
+	"is not running",
+}
+
+// transientErrorMarkers are substrings of Databricks error messages
+// returned for failures which may succeed when retried.
+var transientErrorMarkers = []string{
+	"429 Too Many Requests",
+	"REQUEST_LIMIT_EXCEEDED",
+	"RATE_LIMIT_EXCEEDED",
+	"is starting",
+}
+
+// classifyError wraps err with the matching typed error, if there is one.
+func classifyError(err error) error {
+	if err == nil || errors.Is(err, ErrPermissionDenied) {
+		return err
+	}
+	if isPermissionDenied(err) {
+		return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
+	}
+
+	return err
+}
+
+func isPermissionDenied(err error) bool {
+	return containsAny(err.Error(), permissionDeniedMarkers)
+}
+
+// isSchemaError returns true if err was caused by a statement
+// which doesn't match the current table schema.
+func isSchemaError(err error) bool {
+	return containsAny(err.Error(), schemaErrorMarkers)
+}
+
+// isTableNotFound returns true if err was caused by a table which doesn't exist.
+func isTableNotFound(err error) bool {
+	return containsAny(err.Error(), tableNotFoundMarkers)
+}
+
+// isCastError returns true if err was caused by a value
+// which can't be cast implicitly to the column type.
+func isCastError(err error) bool {
+	return containsAny(err.Error(), castErrorMarkers)
+}
+
+// isConnectionError returns true if err was caused by
+// a broken connection to the warehouse.
+func isConnectionError(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		containsAny(err.Error(), connectionErrorMarkers)
+}
+
+// isAmbiguousError returns true if err leaves it open whether the failed
+// statement has been executed, because it timed out or the connection broke
+// after the statement was sent. A bad connection is reported by the driver
+// before anything is sent.
+func isAmbiguousError(err error) bool {
+	return errors.Is(err, ErrQueryTimeout) ||
+		(isConnectionError(err) && !errors.Is(err, driver.ErrBadConn))
+}
+
+// isWarehouseUnavailable returns true if err was caused by
+// a warehouse which is stopped or still starting.
+func isWarehouseUnavailable(err error) bool {
+	return containsAny(err.Error(), warehouseUnavailableMarkers)
+}
+
+// isTransientError returns true if err may not occur again when the failed
+// statement is retried, e.g. because the connection was reset, the warehouse
+// is starting or requests are rate limited. Errors caused by the statement
+// itself, like schema and permission errors, are permanent.
+func isTransientError(err error) bool {
+	if isSchemaError(err) || isPermissionDenied(err) || isCastError(err) || errors.Is(err, ErrTypeMismatch) {
+		return false
+	}
+
+	return errors.Is(err, ErrQueryTimeout) ||
+		isConnectionError(err) ||
+		isWarehouseUnavailable(err) ||
+		containsAny(err.Error(), transientErrorMarkers)
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+
+	return false
+}
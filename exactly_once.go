@@ -0,0 +1,169 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// positionsTableSuffix is appended to the table name to get the name of
+// the positions table, when none is configured.
+const positionsTableSuffix = "_positions"
+
+type writeFunc func(ctx context.Context, record opencdc.Record) error
+
+// positionsTable returns the name of the control table which holds
+// the positions of records written in exactly-once mode.
+func (c *sqlClient) positionsTable() string {
+	if c.config.PositionsTable != "" {
+		return c.config.PositionsTable
+	}
+
+	// the suffix goes inside the quotes of a quoted table name
+	if strings.HasSuffix(c.tableName, "`") {
+		return strings.TrimSuffix(c.tableName, "`") + positionsTableSuffix + "`"
+	}
+
+	return c.tableName + positionsTableSuffix
+}
+
+// openPositionsTable creates the positions table, if it doesn't exist
+// yet and autoCreateControlTables is enabled, or checks it otherwise.
+func (c *sqlClient) openPositionsTable(ctx context.Context) error {
+	return c.openControlTable(ctx, c.positionsControlTable())
+}
+
+// writeOnce writes the record using write. In exactly-once mode, records
+// whose position has already been written are skipped, and the position
+// is recorded after a successful write.
+func (c *sqlClient) writeOnce(ctx context.Context, record opencdc.Record, write writeFunc) error {
+	c.refreshColumnsIfDue(ctx)
+	if err := c.createTableFor(ctx, record); err != nil {
+		return err
+	}
+	if !c.config.ExactlyOnce {
+		return write(ctx, record)
+	}
+
+	position, err := c.dedupID(ctx, record)
+	if err != nil {
+		return err
+	}
+	written, err := c.positionWritten(ctx, position)
+	if err != nil {
+		return err
+	}
+	if written {
+		sdk.Logger(ctx).Trace().Msg("record already written, skipping")
+		return nil
+	}
+
+	if err := write(ctx, record); err != nil {
+		return err
+	}
+
+	return c.recordPosition(ctx, position)
+}
+
+// dedupID returns the value identifying the record in the positions table.
+// That's the value of the idempotency column, if one is configured,
+// or the encoded record position otherwise.
+func (c *sqlClient) dedupID(ctx context.Context, record opencdc.Record) (string, error) {
+	if c.config.IdempotencyColumn == "" {
+		return base64.StdEncoding.EncodeToString(record.Position), nil
+	}
+
+	for _, data := range []opencdc.Data{record.Payload.After, record.Key} {
+		if data == nil || len(data.Bytes()) == 0 {
+			continue
+		}
+		values := make(opencdc.StructuredData)
+		if err := unmarshalData(data.Bytes(), &values); err != nil {
+			return "", fmt.Errorf("error unmarshalling record data: %w", err)
+		}
+		values, err := c.normalizeColumnNames(ctx, values)
+		if err != nil {
+			return "", err
+		}
+		if v, ok := values[c.config.IdempotencyColumn]; ok && v != nil {
+			return dedupValue(v), nil
+		}
+	}
+
+	return "", fmt.Errorf("record has no value for idempotency column %q", c.config.IdempotencyColumn)
+}
+
+// dedupValue formats the value of the idempotency column. Numbers are
+// decoded like the values written to the table and formatted without
+// an exponent, so large integer ids stay exact.
+func dedupValue(v interface{}) string {
+	switch v := v.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case decimalLiteral:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (c *sqlClient) positionWritten(ctx context.Context, position string) (bool, error) {
+	sqlString, err := c.queryBuilder.buildPositionLookup(
+		c.positionsTable(),
+		c.positionsTableColumn(),
+		c.positionsPositionColumn(),
+		c.tableName,
+		position,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed building position lookup query: %w", err)
+	}
+
+	queryCtx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	rows, err := c.db.QueryContext(queryCtx, sqlString)
+	c.logIfSlow(ctx, sqlString, start)
+	if err != nil {
+		return false, fmt.Errorf("failed looking up position: %w", timeoutError(ctx, queryCtx, err))
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
+
+func (c *sqlClient) recordPosition(ctx context.Context, position string) error {
+	sqlString, err := c.queryBuilder.buildInsert(c.positionsTable(), map[string]interface{}{
+		c.positionsTableColumn():    c.tableName,
+		c.positionsPositionColumn(): position,
+	})
+	if err != nil {
+		return fmt.Errorf("failed building position insert query: %w", err)
+	}
+
+	if _, err := c.execContext(ctx, sqlString); err != nil {
+		return fmt.Errorf("failed recording position: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+)
+
+// fakeDB is a database/sql driver which hands every statement
+// to the configured handlers and records the executed SQL.
+type fakeDB struct {
+	mu      sync.Mutex
+	execs   []string
+	args    [][]driver.NamedValue
+	queries []string
+
+	// exec handles statements executed with Exec, returning the number
+	// of affected rows. If nil, every statement affects one row.
+	exec func(ctx context.Context, query string) (int64, error)
+	// query handles statements executed with Query, returning the column
+	// names and rows. If nil, every query returns no rows.
+	query func(ctx context.Context, query string) ([]string, [][]driver.Value, error)
+	// ping handles pings. If nil, every ping succeeds.
+	ping func(ctx context.Context) error
+}
+
+// open returns a *sql.DB backed by f.
+func (f *fakeDB) open() *sql.DB {
+	return sql.OpenDB(f)
+}
+
+// executedArgs returns the arguments of the statements executed so far.
+func (f *fakeDB) executedArgs() [][]driver.NamedValue {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([][]driver.NamedValue(nil), f.args...)
+}
+
+// executed returns the statements executed so far.
+func (f *fakeDB) executed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.execs...)
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: f}, nil
+}
+
+func (f *fakeDB) Driver() driver.Driver {
+	return fakeDriver{db: f}
+}
+
+type fakeDriver struct {
+	db *fakeDB
+}
+
+func (d fakeDriver) Open(string) (driver.Conn, error) {
+	return &fakeConn{db: d.db}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Ping(ctx context.Context) error {
+	if c.db.ping == nil {
+		return nil
+	}
+
+	return c.db.ping(ctx)
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+// CheckNamedValue accepts every argument as it is, like the Databricks
+// driver accepts its typed parameters.
+func (c *fakeConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	c.db.execs = append(c.db.execs, query)
+	c.db.args = append(c.db.args, args)
+	c.db.mu.Unlock()
+
+	if c.db.exec == nil {
+		return driver.RowsAffected(1), nil
+	}
+	affected, err := c.db.exec(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(affected), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	c.db.queries = append(c.db.queries, query)
+	c.db.mu.Unlock()
+
+	if c.db.query == nil {
+		return &fakeRows{}, nil
+	}
+	cols, rows, err := c.db.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeRows{columns: cols, rows: rows}, nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, nil)
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, nil)
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+
+	return nil
+}
@@ -0,0 +1,311 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+)
+
+const (
+	// quoteAll quotes every segment of an identifier.
+	quoteAll = "all"
+	// quoteMinimal only quotes segments which are reserved words
+	// or contain characters other than letters, digits and underscores.
+	quoteMinimal = "minimal"
+)
+
+// Normalizations applied to field names before they're used as column names.
+const (
+	columnNameLower = "lower"
+	columnNameSnake = "snake"
+)
+
+// Policies for fields whose normalized names collide.
+const (
+	// collisionError fails the record.
+	collisionError = "error"
+	// collisionFirst keeps the value of the first field,
+	// in lexical order of the field names.
+	collisionFirst = "first"
+	// collisionLast keeps the value of the last field,
+	// in lexical order of the field names.
+	collisionLast = "last"
+)
+
+var plainIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedWords are the words reserved by Databricks SQL in ANSI mode.
+// https://docs.databricks.com/sql/language-manual/sql-ref-reserved-words.html
+var reservedWords = map[string]bool{
+	"ALL": true, "ALTER": true, "AND": true, "ANTI": true, "ANY": true, "ARRAY": true,
+	"AS": true, "AT": true, "AUTHORIZATION": true, "BETWEEN": true, "BOTH": true, "BY": true,
+	"CASE": true, "CAST": true, "CHECK": true, "COLLATE": true, "COLUMN": true, "COMMIT": true,
+	"CONSTRAINT": true, "CREATE": true, "CROSS": true, "CUBE": true, "CURRENT": true,
+	"CURRENT_DATE": true, "CURRENT_TIME": true, "CURRENT_TIMESTAMP": true, "CURRENT_USER": true,
+	"DELETE": true, "DESCRIBE": true, "DISTINCT": true, "DROP": true, "ELSE": true, "END": true,
+	"ESCAPE": true, "EXCEPT": true, "EXISTS": true, "EXTERNAL": true, "FALSE": true, "FETCH": true,
+	"FILTER": true, "FOR": true, "FOREIGN": true, "FROM": true, "FULL": true, "FUNCTION": true,
+	"GLOBAL": true, "GRANT": true, "GROUP": true, "GROUPING": true, "HAVING": true, "IN": true,
+	"INNER": true, "INSERT": true, "INTERSECT": true, "INTERVAL": true, "INTO": true, "IS": true,
+	"JOIN": true, "LATERAL": true, "LEADING": true, "LEFT": true, "LIKE": true, "LOCAL": true,
+	"MINUS": true, "NATURAL": true, "NO": true, "NOT": true, "NULL": true, "OF": true, "ON": true,
+	"ONLY": true, "OR": true, "ORDER": true, "OUT": true, "OUTER": true, "OVERLAPS": true,
+	"PARTITION": true, "POSITION": true, "PRIMARY": true, "RANGE": true, "REFERENCES": true,
+	"REVOKE": true, "RIGHT": true, "ROLLBACK": true, "ROLLUP": true, "ROW": true, "ROWS": true,
+	"SELECT": true, "SEMI": true, "SESSION_USER": true, "SET": true, "SOME": true, "START": true,
+	"TABLE": true, "TABLESAMPLE": true, "THEN": true, "TIME": true, "TO": true, "TRAILING": true,
+	"TRUE": true, "UNION": true, "UNIQUE": true, "UNKNOWN": true, "UPDATE": true, "USER": true,
+	"USING": true, "VALUES": true, "WHEN": true, "WHERE": true, "WINDOW": true, "WITH": true,
+}
+
+// tableIdentifier composes the table identifier used in generated statements.
+// With quoteAll, the table is handed to goqu, which quotes every segment,
+// unless some segments are quoted already, in which case only the others
+// are quoted. With quoteMinimal, segments that are safe to use as they are,
+// as well as segments that are already quoted, are left untouched.
+func tableIdentifier(table string, quoting string) interface{} {
+	if quoting != quoteMinimal && !strings.Contains(table, "`") {
+		return table
+	}
+
+	segments := splitIdentifier(table)
+	for i, s := range segments {
+		switch {
+		case quoting == quoteMinimal:
+			segments[i] = quoteSegment(s)
+		case !isQuoted(s):
+			segments[i] = quoteIdentifier(s)
+		}
+	}
+
+	// the literal is wrapped in an identifier, since goqu only
+	// accepts identifiers as the table of a DELETE statement
+	return exp.NewIdentifierExpression("", "", goqu.L(strings.Join(segments, ".")))
+}
+
+// quoteSegment quotes a single identifier segment, if needed.
+func quoteSegment(s string) string {
+	if isQuoted(s) {
+		return s
+	}
+	if plainIdentifier.MatchString(s) && !reservedWords[strings.ToUpper(s)] {
+		return s
+	}
+
+	return quoteIdentifier(s)
+}
+
+// quoteIdentifier encloses s in backticks, escaping backticks in s.
+func quoteIdentifier(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+// isQuoted returns true if s is enclosed in backticks, with every backtick
+// inside escaped, so that s is a single quoted identifier.
+func isQuoted(s string) bool {
+	if len(s) < 2 || !strings.HasPrefix(s, "`") || !strings.HasSuffix(s, "`") {
+		return false
+	}
+
+	return !strings.Contains(strings.ReplaceAll(s[1:len(s)-1], "``", ""), "`")
+}
+
+// maxTableSegments is the number of segments of a fully qualified
+// table name: catalog, schema and table.
+const maxTableSegments = 3
+
+// validateTableName checks that name is a table name of at most three
+// dot-separated segments, each either quoted in backticks or consisting of
+// letters, digits, underscores and hyphens. Table names end up in statements
+// as they are, e.g. in DESCRIBE, so anything else is rejected.
+func validateTableName(name string) error {
+	if strings.Count(name, "`")%2 != 0 {
+		return fmt.Errorf("%w: table name %q has an unterminated quote", ErrInvalidIdentifier, name)
+	}
+	segments := splitIdentifier(name)
+	if len(segments) > maxTableSegments {
+		return fmt.Errorf("%w: table name %q has more than %v segments", ErrInvalidIdentifier, name, maxTableSegments)
+	}
+
+	for _, s := range segments {
+		switch {
+		case s == "":
+			return fmt.Errorf("%w: table name %q has an empty segment", ErrInvalidIdentifier, name)
+		case strings.HasPrefix(s, "`"):
+			if !isQuoted(s) {
+				return fmt.Errorf("%w: segment %s of table name %q isn't quoted correctly", ErrInvalidIdentifier, s, name)
+			}
+		case strings.Contains(s, "--"):
+			return fmt.Errorf("%w: segment %q of table name %q contains a comment", ErrInvalidIdentifier, s, name)
+		default:
+			for _, r := range s {
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+					return fmt.Errorf("%w: segment %q of table name %q contains %q, quote it in backticks", ErrInvalidIdentifier, s, name, r)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateColumnNames checks that the column names can be quoted safely.
+// goqu encloses column names in backticks without escaping backticks in
+// them, so names containing backticks are rejected, as well as names with
+// control characters.
+func validateColumnNames(columns ...string) error {
+	for _, col := range columns {
+		if col == "" {
+			return fmt.Errorf("%w: empty column name", ErrInvalidIdentifier)
+		}
+		if strings.ContainsFunc(col, func(r rune) bool { return r == '`' || unicode.IsControl(r) }) {
+			return fmt.Errorf("%w: column name %q contains a backtick or a control character", ErrInvalidIdentifier, col)
+		}
+	}
+
+	return nil
+}
+
+// validateColumnsOf checks the names of the columns in values.
+func validateColumnsOf(values map[string]interface{}) error {
+	for col := range values {
+		if err := validateColumnNames(col); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitIdentifier splits a dot-separated identifier into its segments,
+// ignoring dots inside backtick-quoted segments.
+func splitIdentifier(s string) []string {
+	var segments []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range s {
+		switch {
+		case r == '`':
+			quoted = !quoted
+			current.WriteRune(r)
+		case r == '.' && !quoted:
+			segments = append(segments, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	return append(segments, current.String())
+}
+
+// normalizeColumnNames returns data with its fields renamed as configured
+// by columnMapping, or their names normalized as configured by
+// columnNameNormalize otherwise, and spelled as the matching table columns,
+// ignoring case. Fields whose normalized names collide, e.g. fullTime and
+// full_time, or Name and name, are handled as configured by collisionPolicy.
+func (c *sqlClient) normalizeColumnNames(ctx context.Context, data opencdc.StructuredData) (opencdc.StructuredData, error) {
+	normalize := c.config.ColumnNameNormalize == columnNameLower || c.config.ColumnNameNormalize == columnNameSnake
+	if !normalize && len(c.config.ColumnMapping) == 0 && c.matchesColumnCase(data) {
+		return data, nil
+	}
+
+	// fields are visited in lexical order, so first and last are deterministic
+	fields := make([]string, 0, len(data))
+	for k := range data {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+
+	normalized := make(opencdc.StructuredData, len(data))
+	sources := make(map[string]string, len(data))
+	for _, field := range fields {
+		// Databricks column names are case-insensitive, so the fields are
+		// mapped to the columns as they are spelled in the table
+		column := c.canonicalColumn(c.columnFor(field))
+		first, collides := sources[column]
+		if !collides {
+			normalized[column] = data[field]
+			sources[column] = field
+			continue
+		}
+
+		switch c.config.CollisionPolicy {
+		case collisionFirst:
+			sdk.Logger(ctx).Warn().
+				Str("column", column).
+				Str("kept", first).
+				Str("dropped", field).
+				Msg("fields collide after normalization, keeping the first")
+		case collisionLast:
+			sdk.Logger(ctx).Warn().
+				Str("column", column).
+				Str("kept", field).
+				Str("dropped", first).
+				Msg("fields collide after normalization, keeping the last")
+			normalized[column] = data[field]
+			sources[column] = field
+		default:
+			return nil, fmt.Errorf("%w: fields %q and %q both map to column %q", ErrColumnCollision, first, field, column)
+		}
+	}
+
+	return normalized, nil
+}
+
+// matchesColumnCase returns true if no field in data needs to be renamed
+// to match the case of a table column.
+func (c *sqlClient) matchesColumnCase(data opencdc.StructuredData) bool {
+	for field := range data {
+		if c.canonicalColumn(field) != field {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeColumnName lowercases name. With columnNameSnake, words in
+// camelCase and PascalCase names are separated with underscores first,
+// e.g. FullTime becomes full_time and HTTPPath becomes http_path.
+func normalizeColumnName(name string, mode string) string {
+	if mode != columnNameSnake {
+		return strings.ToLower(name)
+	}
+
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
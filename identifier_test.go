@@ -0,0 +1,310 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+)
+
+func TestTableIdentifier_Minimal(t *testing.T) {
+	testCases := []struct {
+		name  string
+		table string
+		want  string
+	}{
+		{
+			name:  "all segments safe",
+			table: "main.sales.orders",
+			want:  "main.sales.orders",
+		},
+		{
+			name:  "reserved word",
+			table: "main.sales.order",
+			want:  "main.sales.`order`",
+		},
+		{
+			name:  "special characters",
+			table: "main.my-schema.orders",
+			want:  "main.`my-schema`.orders",
+		},
+		{
+			name:  "already quoted segment with a dot",
+			table: "`my.catalog`.sales.orders",
+			want:  "`my.catalog`.sales.orders",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &ansiQueryBuilder{identifierQuoting: quoteMinimal}
+			sql, err := underTest.buildDelete(tc.table, newRecordKey(map[string]interface{}{"id": 1}, nil))
+			is.NoErr(err)
+			is.Equal("DELETE FROM "+tc.want+" WHERE (`id` = 1)", sql)
+
+			// statements composed by hand quote the table the same way
+			assertTableStatements(is, underTest, tc.table, tc.want)
+		})
+	}
+}
+
+func TestTableIdentifier_All(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &ansiQueryBuilder{identifierQuoting: quoteAll}
+	sql, err := underTest.buildDelete("main.sales.orders", newRecordKey(map[string]interface{}{"id": 1}, nil))
+	is.NoErr(err)
+	is.Equal("DELETE FROM `main`.`sales`.`orders` WHERE (`id` = 1)", sql)
+
+	assertTableStatements(is, underTest, "main.sales.orders", "`main`.`sales`.`orders`")
+}
+
+// assertTableStatements checks that the statements which aren't built with
+// goqu refer to table as want.
+func assertTableStatements(is *is.I, b *ansiQueryBuilder, table string, want string) {
+	types := map[string]string{"id": "BIGINT"}
+	is.Equal("DESCRIBE "+want, b.describeTable(table))
+	is.Equal("DESCRIBE HISTORY "+want+" LIMIT 1", b.describeHistory(table))
+	is.Equal("SHOW TBLPROPERTIES "+want+" ('delta.enableChangeDataFeed')", b.showChangeDataFeed(table))
+	is.Equal("CREATE TABLE IF NOT EXISTS "+want+" (`id` BIGINT)", b.createTable(table, []string{"id"}, types))
+	is.Equal("ALTER TABLE "+want+" ADD COLUMNS (`id` BIGINT)", b.addColumns(table, []string{"id"}, types))
+}
+
+func TestNormalizeColumnName(t *testing.T) {
+	testCases := []struct {
+		name  string
+		mode  string
+		field string
+		want  string
+	}{
+		{name: "snake PascalCase", mode: columnNameSnake, field: "FullTime", want: "full_time"},
+		{name: "snake camelCase", mode: columnNameSnake, field: "fullTime", want: "full_time"},
+		{name: "snake acronym", mode: columnNameSnake, field: "HTTPPath", want: "http_path"},
+		{name: "snake digits", mode: columnNameSnake, field: "address2Line", want: "address2_line"},
+		{name: "snake already snake_case", mode: columnNameSnake, field: "full_time", want: "full_time"},
+		{name: "lower PascalCase", mode: columnNameLower, field: "FullTime", want: "fulltime"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(tc.want, normalizeColumnName(tc.field, tc.mode))
+		})
+	}
+}
+
+func TestSqlClient_NormalizeColumnNames_None(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &sqlClient{config: Config{ColumnNameNormalize: "none"}}
+	data := opencdc.StructuredData{"FullTime": true}
+	got, err := underTest.normalizeColumnNames(context.Background(), data)
+	is.NoErr(err)
+	is.Equal(data, got)
+}
+
+func TestSqlClient_NormalizeColumnNames_TableCase(t *testing.T) {
+	testCases := []struct {
+		mode string
+		data opencdc.StructuredData
+		want opencdc.StructuredData
+	}{
+		{
+			mode: "none",
+			data: opencdc.StructuredData{"fulltime": true, "NAME": "Alice", "other": 1},
+			want: opencdc.StructuredData{"FullTime": true, "Name": "Alice", "other": 1},
+		},
+		{
+			mode: "snake",
+			data: opencdc.StructuredData{"fullTime": true, "name": "Alice"},
+			want: opencdc.StructuredData{"Full_Time": true, "Name": "Alice"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mode, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &sqlClient{
+				config:         Config{ColumnNameNormalize: tc.mode},
+				columnTypes:    map[string]string{"FullTime": "boolean", "Full_Time": "boolean", "Name": "string"},
+				columnsByLower: map[string]string{"fulltime": "FullTime", "full_time": "Full_Time", "name": "Name"},
+			}
+			got, err := underTest.normalizeColumnNames(context.Background(), tc.data)
+			is.NoErr(err)
+			is.Equal(tc.want, got)
+		})
+	}
+}
+
+func TestSqlClient_NormalizeColumnNames_ColumnMapping(t *testing.T) {
+	is := is.New(t)
+
+	// mapped fields aren't normalized, and collide like normalized ones
+	underTest := &sqlClient{config: Config{
+		ColumnNameNormalize: "snake",
+		CollisionPolicy:     "last",
+		ColumnMapping:       map[string]string{"userID": "user_id", "createdAt": "CreatedAt", "uid": "full_name"},
+	}}
+	data := opencdc.StructuredData{"userID": 7, "createdAt": "2024-01-01", "fullName": "Alice", "uid": "alice"}
+	got, err := underTest.normalizeColumnNames(context.Background(), data)
+	is.NoErr(err)
+	is.Equal(opencdc.StructuredData{"user_id": 7, "CreatedAt": "2024-01-01", "full_name": "alice"}, got)
+}
+
+func TestSqlClient_NormalizeColumnNames_Collision(t *testing.T) {
+	data := opencdc.StructuredData{"fullTime": true, "full_time": false, "name": "Alice"}
+
+	testCases := []struct {
+		policy  string
+		want    opencdc.StructuredData
+		wantErr error
+	}{
+		{policy: "error", wantErr: ErrColumnCollision},
+		{policy: "first", want: opencdc.StructuredData{"full_time": true, "name": "Alice"}},
+		{policy: "last", want: opencdc.StructuredData{"full_time": false, "name": "Alice"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.policy, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &sqlClient{config: Config{ColumnNameNormalize: "snake", CollisionPolicy: tc.policy}}
+			got, err := underTest.normalizeColumnNames(context.Background(), data)
+			is.True(errors.Is(err, tc.wantErr))
+			is.Equal(tc.want, got)
+		})
+	}
+}
+
+func TestConfig_QualifiedTableName(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{
+			name:   "table name",
+			config: Config{TableName: "main.sales.orders"},
+			want:   "main.sales.orders",
+		},
+		{
+			name:   "three-part name takes precedence",
+			config: Config{TableName: "main.sales.orders", Catalog: "main", Schema: "sales", Table: "order"},
+			want:   "`main`.`sales`.`order`",
+		},
+		{
+			name:   "table with a dot",
+			config: Config{Schema: "sales", Table: "orders.2023"},
+			want:   "`sales`.`orders.2023`",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(tc.want, tc.config.qualifiedTableName())
+		})
+	}
+}
+
+func TestTableIdentifier_AllQuotedSegments(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &ansiQueryBuilder{identifierQuoting: quoteAll}
+	sql, err := underTest.buildDelete("`main`.`sales`.`order`", newRecordKey(map[string]interface{}{"id": 1}, nil))
+	is.NoErr(err)
+	is.Equal("DELETE FROM `main`.`sales`.`order` WHERE (`id` = 1)", sql)
+
+	sql, err = underTest.buildDelete("main.`my.schema`.orders", newRecordKey(map[string]interface{}{"id": 1}, nil))
+	is.NoErr(err)
+	is.Equal("DELETE FROM `main`.`my.schema`.`orders` WHERE (`id` = 1)", sql)
+}
+
+func TestSanitizeTableName(t *testing.T) {
+	testCases := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "events_eu", want: "events_eu"},
+		{name: "main.sales.events_eu", want: "main.sales.events_eu"},
+		{name: "events_eu-west", want: "events_eu_west"},
+		{name: "events`; DROP TABLE users; --", want: "events___DROP_TABLE_users____"},
+		{name: "", wantErr: true},
+		{name: "main..events", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			got, err := sanitizeTableName(tc.name)
+			is.Equal(tc.wantErr, err != nil)
+			is.Equal(tc.want, got)
+		})
+	}
+}
+
+func TestValidateTableName(t *testing.T) {
+	valid := []string{
+		"products",
+		"main.default.products",
+		"my-catalog.default.products_2",
+		"`main`.`my schema`.`it``s`",
+		"`a.b`.products",
+	}
+	for _, name := range valid {
+		t.Run(name, func(t *testing.T) {
+			is.New(t).NoErr(validateTableName(name))
+		})
+	}
+
+	invalid := []string{
+		"",
+		"main..products",
+		"a.b.c.d",
+		"products; DROP TABLE users",
+		"products--",
+		"my table",
+		"`products",
+		"`products`; DROP TABLE `users`",
+		"`a`b`",
+		"products\n",
+	}
+	for _, name := range invalid {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+			err := validateTableName(name)
+			is.True(errors.Is(err, ErrInvalidIdentifier))
+		})
+	}
+}
+
+func TestIsQuoted(t *testing.T) {
+	is := is.New(t)
+
+	is.True(isQuoted("`products`"))
+	is.True(isQuoted("`it``s`"))
+	is.True(!isQuoted("`a`b`"))
+	is.True(!isQuoted("`a`; DROP TABLE `b`"))
+	is.True(!isQuoted("`"))
+}
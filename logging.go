@@ -0,0 +1,78 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// Fields which can be attached to every log line.
+const (
+	logFieldConnectorID = "connector_id"
+	logFieldTable       = "table"
+	logFieldOperation   = "operation"
+)
+
+// validateLogFields checks that only known log fields are configured.
+func (c Config) validateLogFields() error {
+	for _, f := range c.LogFields {
+		switch f {
+		case logFieldConnectorID, logFieldTable, logFieldOperation:
+		default:
+			return fmt.Errorf("unknown log field %q, expected one of %q, %q or %q",
+				f, logFieldConnectorID, logFieldTable, logFieldOperation)
+		}
+	}
+
+	return nil
+}
+
+// withLogFields returns a context whose logger carries the configured log
+// fields. Without a record, the connector fields are added, with a record
+// only the record fields are added, since the connector fields are expected
+// to be in ctx already. When records are routed to tables, the table is a
+// record field, taken from the table in ctx, so ctx needs to be routed to
+// the table of the record first.
+func (c Config) withLogFields(ctx context.Context, record *opencdc.Record) context.Context {
+	if len(c.LogFields) == 0 {
+		return ctx
+	}
+
+	routed := c.TableMetadataKey != "" || c.TableNameTemplate != ""
+	logCtx := sdk.Logger(ctx).With()
+	for _, f := range c.LogFields {
+		switch {
+		case f == logFieldConnectorID && record == nil:
+			logCtx = logCtx.Str(f, sdk.ConnectorIDFromContext(ctx))
+		case f == logFieldTable && record == nil && !routed:
+			logCtx = logCtx.Str(f, c.qualifiedTableName())
+		case f == logFieldTable && record != nil && routed:
+			table := c
+			if t := tableFromContext(ctx); t != "" {
+				table = c.withTable(t)
+			}
+			logCtx = logCtx.Str(f, table.qualifiedTableName())
+		case f == logFieldOperation && record != nil:
+			logCtx = logCtx.Str(f, record.Operation.String())
+		}
+	}
+	logger := logCtx.Logger()
+
+	return logger.WithContext(ctx)
+}
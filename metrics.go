@@ -0,0 +1,123 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the buckets
+// of the write latency histogram.
+var latencyBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// Metrics counts the records written by a destination and measures the
+// latency of its writes. The destination updates them after every call to
+// Write, they can be read concurrently with Snapshot.
+type Metrics struct {
+	mu       sync.Mutex
+	snapshot MetricsSnapshot
+}
+
+// MetricsSnapshot holds the values of the metrics at one point in time.
+type MetricsSnapshot struct {
+	// Inserted is the number of create and snapshot records written.
+	Inserted int64
+	// Updated is the number of update records written.
+	Updated int64
+	// Deleted is the number of delete records written.
+	Deleted int64
+	// DeadLettered is the number of records which weren't written,
+	// but reported through the results callback instead.
+	DeadLettered int64
+	// Failed is the number of calls to Write which failed.
+	Failed int64
+	// Bytes is the size of the keys and payloads of the records written.
+	Bytes int64
+	// WriteLatency is the histogram of the time the calls to Write took.
+	WriteLatency LatencyHistogram
+}
+
+// LatencyHistogram counts latencies in buckets.
+type LatencyHistogram struct {
+	// Buckets are the upper bounds of the buckets.
+	Buckets []time.Duration
+	// Counts holds the number of latencies in every bucket, the last
+	// count is for latencies greater than the last bucket.
+	Counts []int64
+	// Count is the number of latencies measured.
+	Count int64
+	// Sum is the sum of the latencies measured.
+	Sum time.Duration
+}
+
+// NewMetrics creates metrics with all values at zero.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		snapshot: MetricsSnapshot{
+			WriteLatency: LatencyHistogram{
+				Buckets: latencyBuckets,
+				Counts:  make([]int64, len(latencyBuckets)+1),
+			},
+		},
+	}
+}
+
+// observe adds the results of a call to Write, which took latency.
+func (m *Metrics) observe(results WriteResults, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := &m.snapshot
+	s.Inserted += int64(results.Inserted)
+	s.Updated += int64(results.Updated)
+	s.Deleted += int64(results.Deleted)
+	s.DeadLettered += int64(len(results.DeadLettered))
+	s.Bytes += int64(results.Bytes)
+	if results.Err != nil {
+		s.Failed++
+	}
+
+	bucket := len(s.WriteLatency.Buckets)
+	for i, b := range s.WriteLatency.Buckets {
+		if latency <= b {
+			bucket = i
+			break
+		}
+	}
+	s.WriteLatency.Counts[bucket]++
+	s.WriteLatency.Count++
+	s.WriteLatency.Sum += latency
+}
+
+// Snapshot returns the current values of the metrics.
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.snapshot
+	s.WriteLatency.Counts = append([]int64(nil), s.WriteLatency.Counts...)
+
+	return s
+}
@@ -56,6 +56,20 @@ func (mr *ClientMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*Client)(nil).Close))
 }
 
+// CopyInto mocks base method.
+func (m *Client) CopyInto(ctx context.Context, records []opencdc.Record) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CopyInto", ctx, records)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CopyInto indicates an expected call of CopyInto.
+func (mr *ClientMockRecorder) CopyInto(ctx, records any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CopyInto", reflect.TypeOf((*Client)(nil).CopyInto), ctx, records)
+}
+
 // Delete mocks base method.
 func (m *Client) Delete(ctx context.Context, record opencdc.Record) error {
 	m.ctrl.T.Helper()
@@ -84,6 +98,20 @@ func (mr *ClientMockRecorder) Insert(ctx, record any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Insert", reflect.TypeOf((*Client)(nil).Insert), ctx, record)
 }
 
+// InsertBatch mocks base method.
+func (m *Client) InsertBatch(ctx context.Context, records []opencdc.Record) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InsertBatch", ctx, records)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// InsertBatch indicates an expected call of InsertBatch.
+func (mr *ClientMockRecorder) InsertBatch(ctx, records any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InsertBatch", reflect.TypeOf((*Client)(nil).InsertBatch), ctx, records)
+}
+
 // Open mocks base method.
 func (m *Client) Open(arg0 context.Context, arg1 databricks.Config) error {
 	m.ctrl.T.Helper()
@@ -98,6 +126,21 @@ func (mr *ClientMockRecorder) Open(arg0, arg1 any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Open", reflect.TypeOf((*Client)(nil).Open), arg0, arg1)
 }
 
+// ReadBack mocks base method.
+func (m *Client) ReadBack(ctx context.Context, record opencdc.Record) (opencdc.StructuredData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadBack", ctx, record)
+	ret0, _ := ret[0].(opencdc.StructuredData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadBack indicates an expected call of ReadBack.
+func (mr *ClientMockRecorder) ReadBack(ctx, record any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadBack", reflect.TypeOf((*Client)(nil).ReadBack), ctx, record)
+}
+
 // Update mocks base method.
 func (m *Client) Update(ctx context.Context, record opencdc.Record) error {
 	m.ctrl.T.Helper()
@@ -111,3 +154,17 @@ func (mr *ClientMockRecorder) Update(ctx, record any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*Client)(nil).Update), ctx, record)
 }
+
+// Upsert mocks base method.
+func (m *Client) Upsert(ctx context.Context, record opencdc.Record) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Upsert", ctx, record)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Upsert indicates an expected call of Upsert.
+func (mr *ClientMockRecorder) Upsert(ctx, record any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upsert", reflect.TypeOf((*Client)(nil).Upsert), ctx, record)
+}
@@ -0,0 +1,73 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// validateProxy checks that the proxy URL, if one is configured, is
+// complete and isn't combined with a DSN, which can't be given a transport.
+func (c Config) validateProxy() error {
+	if c.ProxyURL == "" {
+		return nil
+	}
+	if c.DSN != "" {
+		return fmt.Errorf("%v can't be combined with %v", ConfigProxyUrl, ConfigDsn)
+	}
+
+	u, err := url.Parse(c.ProxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid %v: %w", ConfigProxyUrl, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return fmt.Errorf("invalid %v %q: the scheme needs to be http, https or socks5", ConfigProxyUrl, u.Redacted())
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid %v %q: the host is missing", ConfigProxyUrl, u.Redacted())
+	}
+
+	return nil
+}
+
+// proxyTransport returns a transport which connects to the warehouse
+// through the configured proxy, unless the host matches noProxy.
+// Credentials in the proxy URL are used to authenticate with the proxy.
+func (c Config) proxyTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = c.proxyFunc()
+
+	return t
+}
+
+// proxyFunc returns the function choosing the proxy for a request.
+func (c Config) proxyFunc() func(*http.Request) (*url.URL, error) {
+	proxy := (&httpproxy.Config{
+		HTTPProxy:  c.ProxyURL,
+		HTTPSProxy: c.ProxyURL,
+		NoProxy:    strings.Join(c.NoProxy, ","),
+	}).ProxyFunc()
+
+	return func(r *http.Request) (*url.URL, error) {
+		return proxy(r.URL)
+	}
+}
@@ -16,9 +16,13 @@ package databricks
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"golang.org/x/exp/slices"
 )
 
 func init() {
@@ -26,12 +30,68 @@ func init() {
 	// Databricks identifiers are enclosed in backticks
 	// https://docs.databricks.com/sql/language-manual/sql-ref-identifiers.html
 	opts.QuoteRune = '`'
+	// backslashes escape characters in string literals, and adjacent
+	// literals are concatenated, so quotes are escaped with a backslash
+	// https://docs.databricks.com/sql/language-manual/data-types/string-type.html
+	opts.EscapedRunes = map[rune][]byte{
+		'\'': []byte(`\'`),
+		'\\': []byte(`\\`),
+	}
 	goqu.RegisterDialect("databricks-dialect", opts)
 }
 
 var dialect = goqu.Dialect("databricks-dialect")
 
+// recordKey holds the columns and values identifying a row, with the columns
+// kept in the order in which they appear in WHERE clauses.
+type recordKey struct {
+	columns []string
+	values  map[string]interface{}
+}
+
+// newRecordKey creates a recordKey from values. Columns which appear in order
+// come first, in that order, followed by any remaining columns sorted by name.
+func newRecordKey(values map[string]interface{}, order []string) recordKey {
+	columns := make([]string, 0, len(values))
+	for _, col := range order {
+		if _, ok := values[col]; ok {
+			columns = append(columns, col)
+		}
+	}
+
+	var rest []string
+	for col := range values {
+		if !slices.Contains(columns, col) {
+			rest = append(rest, col)
+		}
+	}
+	sort.Strings(rest)
+
+	return recordKey{
+		columns: append(columns, rest...),
+		values:  values,
+	}
+}
+
+// where returns one equality predicate per key column, in key column order.
+// Null key values are matched with IS NULL, since = NULL matches no row.
+func (k recordKey) where() []exp.Expression {
+	preds := make([]exp.Expression, len(k.columns))
+	for i, col := range k.columns {
+		if v := k.values[col]; v != nil {
+			preds[i] = goqu.C(col).Eq(v)
+		} else {
+			preds[i] = goqu.C(col).IsNull()
+		}
+	}
+
+	return preds
+}
+
 type ansiQueryBuilder struct {
+	// identifierQuoting controls how table identifiers are quoted,
+	// either quoteAll (default) or quoteMinimal.
+	identifierQuoting string
 }
 
 // buildInsert builds an insert query.
@@ -43,13 +103,20 @@ func (b *ansiQueryBuilder) buildInsert(
 		return "", errors.New("error creating sqlString: insert statements must specify a table")
 	}
 
+	if err := validateTableName(table); err != nil {
+		return "", err
+	}
+	if err := validateColumnsOf(values); err != nil {
+		return "", err
+	}
+
 	var cols []interface{}
 	var vals []interface{}
 	for col, val := range values {
 		cols = append(cols, col)
 		vals = append(vals, val)
 	}
-	q, _, err := dialect.Insert(table).
+	q, _, err := dialect.Insert(tableIdentifier(table, b.identifierQuoting)).
 		Cols(cols...).
 		Vals(vals).
 		ToSQL()
@@ -57,29 +124,330 @@ func (b *ansiQueryBuilder) buildInsert(
 	return q, err
 }
 
-func (b *ansiQueryBuilder) buildUpdate(
+// buildInsertParameterized builds an INSERT statement with a ? placeholder
+// for every value, and returns it with the values in the order of the
+// placeholders. Columns are sorted by name. binaryParameter values are
+// decoded with unbase64, and placeholders of columns with a type in casts
+// are cast to that type.
+func (b *ansiQueryBuilder) buildInsertParameterized(
+	table string,
+	values map[string]interface{},
+	casts map[string]string,
+) (string, []interface{}, error) {
+	if strings.TrimSpace(table) == "" {
+		return "", nil, errors.New("error creating sqlString: insert statements must specify a table")
+	}
+	if len(values) == 0 {
+		return "", nil, errors.New("no values provided")
+	}
+	if err := validateTableName(table); err != nil {
+		return "", nil, err
+	}
+	t, err := b.renderTable(table)
+	if err != nil {
+		return "", nil, err
+	}
+
+	columns := make([]string, 0, len(values))
+	for col := range values {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdentifier(col)
+		placeholders[i] = "?"
+		args[i] = values[col]
+		if b, ok := values[col].(binaryParameter); ok {
+			placeholders[i] = "unbase64(?)"
+			args[i] = string(b)
+		}
+		if dataType, ok := casts[col]; ok {
+			placeholders[i] = "CAST(" + placeholders[i] + " AS " + dataType + ")"
+		}
+	}
+
+	sql := "INSERT INTO " + t + " (" + strings.Join(quoted, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+
+	return sql, args, nil
+}
+
+// buildInsertBatch builds a single INSERT statement for multiple rows.
+// The values of every row need to be in the same order as columns.
+func (b *ansiQueryBuilder) buildInsertBatch(
+	table string,
+	columns []string,
+	rows [][]interface{},
+) (string, error) {
+	if strings.TrimSpace(table) == "" {
+		return "", errors.New("error creating sqlString: insert statements must specify a table")
+	}
+	if len(rows) == 0 {
+		return "", errors.New("no rows provided")
+	}
+
+	if err := validateTableName(table); err != nil {
+		return "", err
+	}
+	if err := validateColumnNames(columns...); err != nil {
+		return "", err
+	}
+
+	cols := make([]interface{}, len(columns))
+	for i, col := range columns {
+		cols[i] = col
+	}
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return "", fmt.Errorf("row %v has %v values, expected %v", i, len(row), len(columns))
+		}
+	}
+	q, _, err := dialect.Insert(tableIdentifier(table, b.identifierQuoting)).
+		Cols(cols...).
+		Vals(rows...).
+		ToSQL()
+
+	return q, err
+}
+
+// buildSelect builds a query which selects at most limit rows ordered by
+// orderingColumn, starting after lastValue and ending with upperBound.
+// If lastValue is nil, rows are selected from the start. If upperBound
+// is nil, rows are selected up to the end.
+func (b *ansiQueryBuilder) buildSelect(
+	table string,
+	orderingColumn string,
+	lastValue interface{},
+	upperBound interface{},
+	limit int,
+) (string, error) {
+	if strings.TrimSpace(table) == "" {
+		return "", errors.New("table name not provided")
+	}
+	if orderingColumn == "" {
+		return "", errors.New("ordering column not provided")
+	}
+
+	if err := validateTableName(table); err != nil {
+		return "", err
+	}
+	if err := validateColumnNames(orderingColumn); err != nil {
+		return "", err
+	}
+
+	q := dialect.From(tableIdentifier(table, b.identifierQuoting)).
+		Order(goqu.C(orderingColumn).Asc()).
+		Limit(uint(limit))
+	if lastValue != nil {
+		q = q.Where(goqu.C(orderingColumn).Gt(lastValue))
+	}
+	if upperBound != nil {
+		q = q.Where(goqu.C(orderingColumn).Lte(upperBound))
+	}
+	sql, _, err := q.ToSQL()
+
+	return sql, err
+}
+
+// buildMaxValue builds a query which selects the greatest value of column.
+func (b *ansiQueryBuilder) buildMaxValue(table string, column string) (string, error) {
+	if strings.TrimSpace(table) == "" {
+		return "", errors.New("table name not provided")
+	}
+
+	if err := validateTableName(table); err != nil {
+		return "", err
+	}
+	if err := validateColumnNames(column); err != nil {
+		return "", err
+	}
+
+	sql, _, err := dialect.From(tableIdentifier(table, b.identifierQuoting)).
+		Select(goqu.MAX(column)).
+		ToSQL()
+
+	return sql, err
+}
+
+// buildSoftDeleted builds a query which selects the rows flagged in
+// softDeleteColumn up to lastValue of the ordering column, which come after
+// the row with the given watermark and ordering value, in order of the
+// watermark column and the ordering column.
+func (b *ansiQueryBuilder) buildSoftDeleted(
+	table string,
+	softDeleteColumn string,
+	watermarkColumn string,
+	orderingColumn string,
+	lastValue interface{},
+	watermark interface{},
+	watermarkLastValue interface{},
+	limit int,
+) (string, error) {
+	if strings.TrimSpace(table) == "" {
+		return "", errors.New("table name not provided")
+	}
+	if softDeleteColumn == "" {
+		return "", errors.New("soft delete column not provided")
+	}
+	if watermarkColumn == "" {
+		return "", errors.New("soft delete watermark column not provided")
+	}
+	if orderingColumn == "" {
+		return "", errors.New("ordering column not provided")
+	}
+
+	if err := validateTableName(table); err != nil {
+		return "", err
+	}
+	if err := validateColumnNames(softDeleteColumn, watermarkColumn, orderingColumn); err != nil {
+		return "", err
+	}
+
+	q := dialect.From(tableIdentifier(table, b.identifierQuoting)).
+		Where(goqu.C(softDeleteColumn).IsTrue(), goqu.C(watermarkColumn).IsNotNull()).
+		Order(goqu.C(watermarkColumn).Asc(), goqu.C(orderingColumn).Asc()).
+		Limit(uint(limit))
+	if lastValue != nil {
+		q = q.Where(goqu.C(orderingColumn).Lte(lastValue))
+	}
+	if watermark != nil {
+		q = q.Where(goqu.Or(
+			goqu.C(watermarkColumn).Gt(watermark),
+			goqu.And(goqu.C(watermarkColumn).Eq(watermark), goqu.C(orderingColumn).Gt(watermarkLastValue)),
+		))
+	}
+	sql, _, err := q.ToSQL()
+
+	return sql, err
+}
+
+// buildUpsert builds a MERGE statement which updates the row matching
+// the key columns, or inserts a new row if there is none.
+func (b *ansiQueryBuilder) buildUpsert(
 	table string,
 	keys map[string]interface{},
 	values map[string]interface{},
 ) (string, error) {
-	if table == "" {
+	if strings.TrimSpace(table) == "" {
 		return "", errors.New("table name not provided")
 	}
 	if len(keys) == 0 {
 		return "", errors.New("no keys provided")
 	}
+
+	if err := validateTableName(table); err != nil {
+		return "", err
+	}
+	if err := validateColumnsOf(keys); err != nil {
+		return "", err
+	}
+	if err := validateColumnsOf(values); err != nil {
+		return "", err
+	}
+
+	row := make(map[string]interface{}, len(keys)+len(values))
+	for col, val := range keys {
+		row[col] = val
+	}
+	for col, val := range values {
+		row[col] = val
+	}
+	columns := make([]string, 0, len(row))
+	for col := range row {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+
+	selects := make([]interface{}, len(columns))
+	quotedColumns := make([]string, len(columns))
+	var on, set, inserted []string
+	for i, col := range columns {
+		selects[i] = goqu.L("?", row[col]).As(col)
+		quoted := quoteIdentifier(col)
+		quotedColumns[i] = quoted
+		if _, ok := keys[col]; ok {
+			on = append(on, "target."+quoted+" = source."+quoted)
+		} else {
+			set = append(set, "target."+quoted+" = source."+quoted)
+		}
+		inserted = append(inserted, "source."+quoted)
+	}
+
+	source, _, err := dialect.Select(selects...).ToSQL()
+	if err != nil {
+		return "", err
+	}
+	target, err := b.renderTable(table)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("MERGE INTO " + target + " AS target USING (" + source + ") AS source ON ")
+	sb.WriteString(strings.Join(on, " AND "))
+	if len(set) > 0 {
+		sb.WriteString(" WHEN MATCHED THEN UPDATE SET " + strings.Join(set, ", "))
+	}
+	sb.WriteString(" WHEN NOT MATCHED THEN INSERT (" + strings.Join(quotedColumns, ", ") + ")")
+	sb.WriteString(" VALUES (" + strings.Join(inserted, ", ") + ")")
+
+	return sb.String(), nil
+}
+
+// renderTable renders the table identifier the same way it's rendered
+// in statements built with goqu.
+func (b *ansiQueryBuilder) renderTable(table string) (string, error) {
+	q, _, err := dialect.From(tableIdentifier(table, b.identifierQuoting)).ToSQL()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimPrefix(q, "SELECT * FROM "), nil
+}
+
+// quotedTable returns table quoted like in the statements built with goqu,
+// for statements which are composed by hand. Rendering a table identifier
+// doesn't fail, but if it did, the table would be used as it is.
+func (b *ansiQueryBuilder) quotedTable(table string) string {
+	t, err := b.renderTable(table)
+	if err != nil {
+		return table
+	}
+
+	return t
+}
+
+func (b *ansiQueryBuilder) buildUpdate(
+	table string,
+	key recordKey,
+	values map[string]interface{},
+) (string, error) {
+	if table == "" {
+		return "", errors.New("table name not provided")
+	}
+	if len(key.columns) == 0 {
+		return "", errors.New("no keys provided")
+	}
 	if len(values) == 0 {
 		return "", errors.New("no values provided")
 	}
 
-	// transforms keys map into a goqu.Ex
-	w := goqu.Ex{}
-	for k, v := range keys {
-		w[k] = v
+	if err := validateTableName(table); err != nil {
+		return "", err
 	}
-	q, _, err := dialect.Update(table).
+	if err := validateColumnNames(key.columns...); err != nil {
+		return "", err
+	}
+	if err := validateColumnsOf(values); err != nil {
+		return "", err
+	}
+
+	q, _, err := dialect.Update(tableIdentifier(table, b.identifierQuoting)).
 		Set(values).
-		Where(w).
+		Where(key.where()...).
 		ToSQL()
 
 	return q, err
@@ -87,27 +455,221 @@ func (b *ansiQueryBuilder) buildUpdate(
 
 func (b *ansiQueryBuilder) buildDelete(
 	table string,
-	keys map[string]interface{},
+	key recordKey,
 ) (string, error) {
 	if table == "" {
 		return "", errors.New("table name not provided")
 	}
-	if len(keys) == 0 {
+	if len(key.columns) == 0 {
+		return "", errors.New("no keys provided")
+	}
+
+	if err := validateTableName(table); err != nil {
+		return "", err
+	}
+	if err := validateColumnNames(key.columns...); err != nil {
+		return "", err
+	}
+
+	q, _, err := dialect.Delete(tableIdentifier(table, b.identifierQuoting)).
+		Where(key.where()...).
+		ToSQL()
+
+	return q, err
+}
+
+// buildSoftDelete builds a statement which marks the row with key as
+// deleted, by setting column to the SQL expression value.
+func (b *ansiQueryBuilder) buildSoftDelete(
+	table string,
+	key recordKey,
+	column string,
+	value string,
+) (string, error) {
+	if column == "" {
+		return "", errors.New("soft delete column not provided")
+	}
+
+	return b.buildUpdate(table, key, map[string]interface{}{column: goqu.L(value)})
+}
+
+// buildPositionLookup builds a query which returns a row if the position
+// has already been written to table. The positions table holds the table
+// name in tableColumn and the position in positionColumn.
+func (b *ansiQueryBuilder) buildPositionLookup(
+	positionsTable string,
+	tableColumn string,
+	positionColumn string,
+	table string,
+	position string,
+) (string, error) {
+	if positionsTable == "" {
+		return "", errors.New("positions table name not provided")
+	}
+
+	if err := validateTableName(positionsTable); err != nil {
+		return "", err
+	}
+	if err := validateColumnNames(tableColumn, positionColumn); err != nil {
+		return "", err
+	}
+
+	q, _, err := dialect.From(tableIdentifier(positionsTable, b.identifierQuoting)).
+		Select(goqu.L("1")).
+		Where(
+			goqu.C(tableColumn).Eq(table),
+			goqu.C(positionColumn).Eq(position),
+		).
+		Limit(1).
+		ToSQL()
+
+	return q, err
+}
+
+// buildReadBack builds a query which selects columns of the row with key.
+func (b *ansiQueryBuilder) buildReadBack(
+	table string,
+	columns []string,
+	key recordKey,
+) (string, error) {
+	if table == "" {
+		return "", errors.New("table name not provided")
+	}
+	if len(columns) == 0 {
+		return "", errors.New("no columns provided")
+	}
+	if len(key.columns) == 0 {
 		return "", errors.New("no keys provided")
 	}
 
-	// transforms keys map into a goqu.Ex
-	w := goqu.Ex{}
-	for k, v := range keys {
-		w[k] = v
+	if err := validateTableName(table); err != nil {
+		return "", err
+	}
+	if err := validateColumnNames(columns...); err != nil {
+		return "", err
+	}
+	if err := validateColumnNames(key.columns...); err != nil {
+		return "", err
+	}
+
+	cols := make([]interface{}, len(columns))
+	for i, col := range columns {
+		cols[i] = goqu.C(col)
 	}
-	q, _, err := dialect.Delete(table).
-		Where(w).
+	q, _, err := dialect.From(tableIdentifier(table, b.identifierQuoting)).
+		Select(cols...).
+		Where(key.where()...).
+		Limit(1).
 		ToSQL()
 
 	return q, err
 }
 
+// buildTableChanges builds a query which selects the changes
+// committed to table in the given version, from its change data feed.
+// The changes are ordered by their change type and, if it's set, the
+// ordering column, so that the order is the same every time the
+// version is read.
+func (b *ansiQueryBuilder) buildTableChanges(table string, orderingColumn string, version int64) (string, error) {
+	if strings.TrimSpace(table) == "" {
+		return "", errors.New("table name not provided")
+	}
+
+	if err := validateTableName(table); err != nil {
+		return "", err
+	}
+
+	order := []exp.OrderedExpression{
+		goqu.C(commitVersionColumn).Asc(),
+		goqu.C(changeTypeColumn).Asc(),
+	}
+	if orderingColumn != "" {
+		if err := validateColumnNames(orderingColumn); err != nil {
+			return "", err
+		}
+		order = append(order, goqu.C(orderingColumn).Asc())
+	}
+
+	sql, _, err := dialect.From(goqu.L("table_changes(?, ?, ?)", table, version, version)).
+		Order(order...).
+		ToSQL()
+
+	return sql, err
+}
+
 func (b *ansiQueryBuilder) describeTable(table string) string {
-	return "DESCRIBE " + table
+	return "DESCRIBE " + b.quotedTable(table)
+}
+
+// describeHistory lists the versions of table, latest first.
+func (b *ansiQueryBuilder) describeHistory(table string) string {
+	return "DESCRIBE HISTORY " + b.quotedTable(table) + " LIMIT 1"
+}
+
+// showChangeDataFeed shows whether the change data feed is enabled on table.
+func (b *ansiQueryBuilder) showChangeDataFeed(table string) string {
+	return "SHOW TBLPROPERTIES " + b.quotedTable(table) + " ('delta.enableChangeDataFeed')"
+}
+
+// showViews lists the views, including temporary ones, named name.
+func (b *ansiQueryBuilder) showViews(name string) string {
+	return "SHOW VIEWS LIKE " + stringLiteral(name)
+}
+
+// createTable creates table, unless it exists, with the columns
+// in the given order and their types.
+func (b *ansiQueryBuilder) createTable(table string, columns []string, types map[string]string) string {
+	return "CREATE TABLE IF NOT EXISTS " + b.quotedTable(table) + " (" + columnDefinitions(columns, types) + ")"
+}
+
+// addColumns adds the columns, in the given order and with their types, to table.
+func (b *ansiQueryBuilder) addColumns(table string, columns []string, types map[string]string) string {
+	return "ALTER TABLE " + b.quotedTable(table) + " ADD COLUMNS (" + columnDefinitions(columns, types) + ")"
+}
+
+// putFile uploads the local file to the staged path, replacing any file
+// that's already there.
+func (b *ansiQueryBuilder) putFile(local string, staged string) string {
+	return "PUT " + stringLiteral(local) + " INTO " + stringLiteral(staged) + " OVERWRITE"
+}
+
+// removeFile removes the staged file.
+func (b *ansiQueryBuilder) removeFile(staged string) string {
+	return "REMOVE " + stringLiteral(staged)
+}
+
+// buildCopyInto builds a statement loading the file in dir, in the given
+// format, into table. CSV files are expected to have a header, by which
+// the columns are matched.
+func (b *ansiQueryBuilder) buildCopyInto(table string, dir string, file string, format string) (string, error) {
+	if err := validateTableName(table); err != nil {
+		return "", err
+	}
+	t, err := b.renderTable(table)
+	if err != nil {
+		return "", err
+	}
+
+	sql := "COPY INTO " + t + " FROM " + stringLiteral(dir) +
+		" FILEFORMAT = " + strings.ToUpper(format) + " FILES = (" + stringLiteral(file) + ")"
+	if strings.EqualFold(format, stagingFormatCSV) {
+		sql += " FORMAT_OPTIONS ('header' = 'true', 'inferSchema' = 'true')"
+	}
+
+	return sql, nil
+}
+
+// stringLiteral quotes s as a string literal.
+func stringLiteral(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	return "'" + strings.ReplaceAll(s, "'", "\\'") + "'"
+}
+
+func columnDefinitions(columns []string, types map[string]string) string {
+	defs := make([]string, len(columns))
+	for i, col := range columns {
+		defs[i] = quoteIdentifier(col) + " " + types[col]
+	}
+
+	return strings.Join(defs, ", ")
 }
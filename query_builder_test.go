@@ -15,6 +15,7 @@
 package databricks
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/matryer/is"
@@ -76,6 +77,55 @@ func TestQueryBuilder_Insert(t *testing.T) {
 	}
 }
 
+func TestQueryBuilder_InsertBatch(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &ansiQueryBuilder{}
+	sql, err := underTest.buildInsertBatch(
+		"test.products",
+		[]string{"id", "name"},
+		[][]interface{}{{1, "computer"}, {2, nil}, {3, "phone"}},
+	)
+	is.NoErr(err)
+	is.Equal("INSERT INTO `test`.`products` (`id`, `name`) VALUES (1, 'computer'), (2, NULL), (3, 'phone')", sql)
+
+	_, err = underTest.buildInsertBatch("test.products", []string{"id", "name"}, [][]interface{}{{1}})
+	is.True(err != nil) // expected an error for a row not matching the columns
+}
+
+func TestQueryBuilder_Upsert(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &ansiQueryBuilder{}
+	sql, err := underTest.buildUpsert(
+		"test.products",
+		map[string]interface{}{"id": 1},
+		map[string]interface{}{"id": 1, "name": "computer", "price": 10},
+	)
+	is.NoErr(err)
+	is.Equal(
+		"MERGE INTO `test`.`products` AS target "+
+			"USING (SELECT 1 AS `id`, 'computer' AS `name`, 10 AS `price`) AS source "+
+			"ON target.`id` = source.`id` "+
+			"WHEN MATCHED THEN UPDATE SET target.`name` = source.`name`, target.`price` = source.`price` "+
+			"WHEN NOT MATCHED THEN INSERT (`id`, `name`, `price`) VALUES (source.`id`, source.`name`, source.`price`)",
+		sql,
+	)
+
+	// a row consisting of keys only is never updated
+	sql, err = underTest.buildUpsert("products", map[string]interface{}{"id": 1}, nil)
+	is.NoErr(err)
+	is.Equal(
+		"MERGE INTO `products` AS target USING (SELECT 1 AS `id`) AS source "+
+			"ON target.`id` = source.`id` "+
+			"WHEN NOT MATCHED THEN INSERT (`id`) VALUES (source.`id`)",
+		sql,
+	)
+
+	_, err = underTest.buildUpsert("products", nil, map[string]interface{}{"name": "computer"})
+	is.True(err != nil) // expected an error for missing keys
+}
+
 func TestQueryBuilder_Update(t *testing.T) {
 	testCases := []struct {
 		name string
@@ -95,6 +145,14 @@ func TestQueryBuilder_Update(t *testing.T) {
 			want:    "UPDATE `test`.`products` SET `name`='strawberry yoghurt' WHERE (`id` = 'a1b2')",
 			wantErr: "",
 		},
+		{
+			name:    "null key value",
+			table:   "test.products",
+			keys:    map[string]interface{}{"id": "a1b2", "region": nil},
+			values:  map[string]interface{}{"name": "strawberry yoghurt"},
+			want:    "UPDATE `test`.`products` SET `name`='strawberry yoghurt' WHERE ((`id` = 'a1b2') AND (`region` IS NULL))",
+			wantErr: "",
+		},
 		{
 			name:    "nil keys",
 			table:   "test.products",
@@ -142,7 +200,7 @@ func TestQueryBuilder_Update(t *testing.T) {
 			is := is.New(t)
 
 			underTest := &ansiQueryBuilder{}
-			sql, err := underTest.buildUpdate(tc.table, tc.keys, tc.values)
+			sql, err := underTest.buildUpdate(tc.table, newRecordKey(tc.keys, nil), tc.values)
 			if tc.wantErr != "" {
 				is.Equal("", sql)
 				is.Equal(tc.wantErr, err.Error())
@@ -160,8 +218,9 @@ func TestQueryBuilder_Delete(t *testing.T) {
 	testCases := []struct {
 		name string
 
-		table string
-		keys  map[string]interface{}
+		table    string
+		keys     map[string]interface{}
+		keyOrder []string
 
 		want    string
 		wantErr string
@@ -173,6 +232,28 @@ func TestQueryBuilder_Delete(t *testing.T) {
 			want:    "DELETE FROM `test`.`products` WHERE (`id` = 'a1b2')",
 			wantErr: "",
 		},
+		{
+			name:    "null key value",
+			table:   "test.products",
+			keys:    map[string]interface{}{"id": "a1b2", "region": nil},
+			want:    "DELETE FROM `test`.`products` WHERE ((`id` = 'a1b2') AND (`region` IS NULL))",
+			wantErr: "",
+		},
+		{
+			name:    "composite key without order",
+			table:   "test.products",
+			keys:    map[string]interface{}{"sku": "a1b2", "region": "eu", "id": 1},
+			want:    "DELETE FROM `test`.`products` WHERE ((`id` = 1) AND (`region` = 'eu') AND (`sku` = 'a1b2'))",
+			wantErr: "",
+		},
+		{
+			name:     "composite key in key column order",
+			table:    "test.products",
+			keys:     map[string]interface{}{"sku": "a1b2", "region": "eu", "id": 1},
+			keyOrder: []string{"region", "sku", "id"},
+			want:     "DELETE FROM `test`.`products` WHERE ((`region` = 'eu') AND (`sku` = 'a1b2') AND (`id` = 1))",
+			wantErr:  "",
+		},
 		{
 			name:    "nil keys",
 			table:   "test.products",
@@ -201,7 +282,70 @@ func TestQueryBuilder_Delete(t *testing.T) {
 			is := is.New(t)
 
 			underTest := &ansiQueryBuilder{}
-			sql, err := underTest.buildDelete(tc.table, tc.keys)
+			sql, err := underTest.buildDelete(tc.table, newRecordKey(tc.keys, tc.keyOrder))
+			if tc.wantErr != "" {
+				is.Equal("", sql)
+				is.Equal(tc.wantErr, err.Error())
+
+				return
+			}
+
+			is.NoErr(err)
+			is.Equal(tc.want, sql)
+		})
+	}
+}
+
+func TestQueryBuilder_SoftDelete(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		table  string
+		keys   map[string]interface{}
+		column string
+		value  string
+
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "boolean flag",
+			table:  "test.products",
+			keys:   map[string]interface{}{"id": "a1b2"},
+			column: "is_deleted",
+			value:  "true",
+			want:   "UPDATE `test`.`products` SET `is_deleted`=true WHERE (`id` = 'a1b2')",
+		},
+		{
+			name:   "timestamp",
+			table:  "test.products",
+			keys:   map[string]interface{}{"sku": "a1b2", "region": "eu"},
+			column: "deleted_at",
+			value:  "current_timestamp()",
+			want:   "UPDATE `test`.`products` SET `deleted_at`=current_timestamp() WHERE ((`region` = 'eu') AND (`sku` = 'a1b2'))",
+		},
+		{
+			name:    "no keys",
+			table:   "test.products",
+			column:  "is_deleted",
+			value:   "true",
+			wantErr: "no keys provided",
+		},
+		{
+			name:    "no column",
+			table:   "test.products",
+			keys:    map[string]interface{}{"id": "a1b2"},
+			value:   "true",
+			wantErr: "soft delete column not provided",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &ansiQueryBuilder{}
+			sql, err := underTest.buildSoftDelete(tc.table, newRecordKey(tc.keys, nil), tc.column, tc.value)
 			if tc.wantErr != "" {
 				is.Equal("", sql)
 				is.Equal(tc.wantErr, err.Error())
@@ -214,3 +358,279 @@ func TestQueryBuilder_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryBuilder_KeyOrder(t *testing.T) {
+	is := is.New(t)
+
+	key := newRecordKey(
+		map[string]interface{}{"region": "eu", "id": 1, "tenant": "acme"},
+		[]string{"tenant", "region", "id"},
+	)
+	is.Equal([]string{"tenant", "region", "id"}, key.columns)
+
+	underTest := &ansiQueryBuilder{}
+	for i := 0; i < 10; i++ {
+		sql, err := underTest.buildUpdate("test.products", key, map[string]interface{}{"name": "computer"})
+		is.NoErr(err)
+		is.Equal(
+			"UPDATE `test`.`products` SET `name`='computer' "+
+				"WHERE ((`tenant` = 'acme') AND (`region` = 'eu') AND (`id` = 1))",
+			sql,
+		)
+
+		sql, err = underTest.buildDelete("test.products", key)
+		is.NoErr(err)
+		is.Equal(
+			"DELETE FROM `test`.`products` "+
+				"WHERE ((`tenant` = 'acme') AND (`region` = 'eu') AND (`id` = 1))",
+			sql,
+		)
+	}
+}
+
+func TestNewRecordKey_UnknownColumnsSorted(t *testing.T) {
+	is := is.New(t)
+
+	key := newRecordKey(
+		map[string]interface{}{"c": 1, "b": 2, "a": 3},
+		[]string{"b"},
+	)
+	is.Equal([]string{"b", "a", "c"}, key.columns)
+}
+
+func TestQueryBuilder_CreateTable(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &ansiQueryBuilder{}
+	sql := underTest.createTable(
+		"`main`.`sales`.`orders`",
+		[]string{"id", "created_at", "full name"},
+		map[string]string{"id": "BIGINT", "created_at": "TIMESTAMP", "full name": "STRING"},
+	)
+	is.Equal(
+		"CREATE TABLE IF NOT EXISTS `main`.`sales`.`orders` (`id` BIGINT, `created_at` TIMESTAMP, `full name` STRING)",
+		sql,
+	)
+}
+
+func TestQueryBuilder_CopyInto(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &ansiQueryBuilder{}
+	sql, err := underTest.buildCopyInto("main.default.products", "/Volumes/main/default/staging", "batch.csv", "csv")
+	is.NoErr(err)
+	is.Equal(
+		"COPY INTO `main`.`default`.`products` FROM '/Volumes/main/default/staging' FILEFORMAT = CSV FILES = ('batch.csv')"+
+			" FORMAT_OPTIONS ('header' = 'true', 'inferSchema' = 'true')",
+		sql,
+	)
+
+	is.Equal(`PUT '/tmp/it\'s\\batch.json' INTO '/Volumes/staging/batch.json' OVERWRITE`, underTest.putFile(`/tmp/it's\batch.json`, "/Volumes/staging/batch.json"))
+	is.Equal("REMOVE '/Volumes/staging/batch.json'", underTest.removeFile("/Volumes/staging/batch.json"))
+}
+
+func TestQueryBuilder_TableChanges(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &ansiQueryBuilder{}
+	sql, err := underTest.buildTableChanges("main.default.products", "id", 6)
+	is.NoErr(err)
+	is.Equal(
+		"SELECT * FROM table_changes('main.default.products', 6, 6) ORDER BY `_commit_version` ASC, `_change_type` ASC, `id` ASC",
+		sql,
+	)
+
+	sql, err = underTest.buildTableChanges("main.default.products", "", 6)
+	is.NoErr(err)
+	is.Equal("SELECT * FROM table_changes('main.default.products', 6, 6) ORDER BY `_commit_version` ASC, `_change_type` ASC", sql)
+}
+
+func TestQueryBuilder_InsertParameterized(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &ansiQueryBuilder{}
+	sql, args, err := underTest.buildInsertParameterized(
+		"main.default.products",
+		map[string]interface{}{"price": 10.5, "id": int64(1), "name": "it's"},
+		map[string]string{"price": "DECIMAL(10,2)"},
+	)
+	is.NoErr(err)
+	is.Equal("INSERT INTO `main`.`default`.`products` (`id`, `name`, `price`) VALUES (?, ?, CAST(? AS DECIMAL(10,2)))", sql)
+	is.Equal([]interface{}{int64(1), "it's", 10.5}, args)
+
+	sql, args, err = underTest.buildInsertParameterized(
+		"files",
+		map[string]interface{}{"content": binaryParameter("AQL/"), "raw": binaryParameter("AA==")},
+		map[string]string{"raw": "BINARY"},
+	)
+	is.NoErr(err)
+	is.Equal("INSERT INTO `files` (`content`, `raw`) VALUES (unbase64(?), CAST(unbase64(?) AS BINARY))", sql)
+	is.Equal([]interface{}{"AQL/", "AA=="}, args)
+
+	_, _, err = underTest.buildInsertParameterized("", map[string]interface{}{"id": 1}, nil)
+	is.True(err != nil)
+	_, _, err = underTest.buildInsertParameterized("products", map[string]interface{}{}, nil)
+	is.True(err != nil)
+}
+
+func TestQueryBuilder_AdversarialIdentifiers(t *testing.T) {
+	value := map[string]interface{}{"name": "cup"}
+	key := newRecordKey(map[string]interface{}{"id": 1}, nil)
+
+	// every builder is called with the given table and column
+	builders := map[string]func(b *ansiQueryBuilder, table, column string) error{
+		"insert": func(b *ansiQueryBuilder, table, column string) error {
+			_, err := b.buildInsert(table, map[string]interface{}{column: 1})
+			return err
+		},
+		"insert batch": func(b *ansiQueryBuilder, table, column string) error {
+			_, err := b.buildInsertBatch(table, []string{column}, [][]interface{}{{1}})
+			return err
+		},
+		"insert parameterized": func(b *ansiQueryBuilder, table, _ string) error {
+			_, _, err := b.buildInsertParameterized(table, value, nil)
+			return err
+		},
+		"update": func(b *ansiQueryBuilder, table, column string) error {
+			_, err := b.buildUpdate(table, key, map[string]interface{}{column: 1})
+			return err
+		},
+		"delete": func(b *ansiQueryBuilder, table, column string) error {
+			_, err := b.buildDelete(table, newRecordKey(map[string]interface{}{column: 1}, nil))
+			return err
+		},
+		"soft delete": func(b *ansiQueryBuilder, table, column string) error {
+			_, err := b.buildSoftDelete(table, key, column, "true")
+			return err
+		},
+		"upsert": func(b *ansiQueryBuilder, table, column string) error {
+			_, err := b.buildUpsert(table, map[string]interface{}{"id": 1}, map[string]interface{}{column: 1})
+			return err
+		},
+		"position lookup": func(b *ansiQueryBuilder, table, column string) error {
+			_, err := b.buildPositionLookup(table, column, "position", "products", "pos-1")
+			return err
+		},
+		"read back": func(b *ansiQueryBuilder, table, column string) error {
+			_, err := b.buildReadBack(table, []string{column}, key)
+			return err
+		},
+		"select": func(b *ansiQueryBuilder, table, column string) error {
+			_, err := b.buildSelect(table, column, nil, nil, 10)
+			return err
+		},
+		"max value": func(b *ansiQueryBuilder, table, column string) error {
+			_, err := b.buildMaxValue(table, column)
+			return err
+		},
+		"soft deleted": func(b *ansiQueryBuilder, table, column string) error {
+			_, err := b.buildSoftDeleted(table, column, "deleted_at", "id", nil, nil, nil, 10)
+			return err
+		},
+		"table changes": func(b *ansiQueryBuilder, table, _ string) error {
+			_, err := b.buildTableChanges(table, "id", 1)
+			return err
+		},
+		"copy into": func(b *ansiQueryBuilder, table, _ string) error {
+			_, err := b.buildCopyInto(table, "/Volumes/staging", "batch.json", "json")
+			return err
+		},
+	}
+
+	tables := []string{
+		"products; DROP TABLE users",
+		"products -- comment",
+		"products/*",
+		"`products`; DROP TABLE `users`",
+		"`products`` DROP TABLE users",
+		"products'",
+		"a.b.c.d",
+	}
+	columns := []string{
+		"name` = 1; DROP TABLE users; --",
+		"name\n",
+	}
+
+	for name, build := range builders {
+		t.Run(name, func(t *testing.T) {
+			is := is.New(t)
+			underTest := &ansiQueryBuilder{}
+
+			is.NoErr(build(underTest, "main.default.products", "name"))
+			for _, table := range tables {
+				err := build(underTest, table, "name")
+				is.True(errors.Is(err, ErrInvalidIdentifier)) // table should be rejected
+			}
+			if name == "insert parameterized" || name == "table changes" || name == "copy into" {
+				return
+			}
+			for _, column := range columns {
+				err := build(underTest, "products", column)
+				is.True(errors.Is(err, ErrInvalidIdentifier)) // column should be rejected
+			}
+		})
+	}
+}
+
+func TestQueryBuilder_AdversarialValues(t *testing.T) {
+	underTest := &ansiQueryBuilder{}
+	values := []string{
+		"'; DROP TABLE users; --",
+		"\\'; DROP TABLE users; --",
+		"it's /* comment */",
+	}
+	escaped := []string{
+		`'\'; DROP TABLE users; --'`,
+		`'\\\'; DROP TABLE users; --'`,
+		`'it\'s /* comment */'`,
+	}
+
+	for i, v := range values {
+		t.Run(v, func(t *testing.T) {
+			is := is.New(t)
+			key := newRecordKey(map[string]interface{}{"id": v}, nil)
+
+			sql, err := underTest.buildInsert("products", map[string]interface{}{"name": v})
+			is.NoErr(err)
+			is.Equal("INSERT INTO `products` (`name`) VALUES ("+escaped[i]+")", sql)
+
+			sql, err = underTest.buildInsertBatch("products", []string{"name"}, [][]interface{}{{v}})
+			is.NoErr(err)
+			is.Equal("INSERT INTO `products` (`name`) VALUES ("+escaped[i]+")", sql)
+
+			sql, err = underTest.buildUpdate("products", key, map[string]interface{}{"name": v})
+			is.NoErr(err)
+			is.Equal("UPDATE `products` SET `name`="+escaped[i]+" WHERE (`id` = "+escaped[i]+")", sql)
+
+			sql, err = underTest.buildDelete("products", key)
+			is.NoErr(err)
+			is.Equal("DELETE FROM `products` WHERE (`id` = "+escaped[i]+")", sql)
+
+			sql, err = underTest.buildUpsert("products", map[string]interface{}{"id": v}, nil)
+			is.NoErr(err)
+			is.Equal("MERGE INTO `products` AS target USING (SELECT "+escaped[i]+" AS `id`) AS source"+
+				" ON target.`id` = source.`id` WHEN NOT MATCHED THEN INSERT (`id`) VALUES (source.`id`)", sql)
+
+			sql, err = underTest.buildPositionLookup("positions", "table_name", "position", v, v)
+			is.NoErr(err)
+			is.Equal("SELECT 1 FROM `positions` WHERE ((`table_name` = "+escaped[i]+") AND (`position` = "+escaped[i]+")) LIMIT 1", sql)
+
+			sql, err = underTest.buildReadBack("products", []string{"name"}, key)
+			is.NoErr(err)
+			is.Equal("SELECT `name` FROM `products` WHERE (`id` = "+escaped[i]+") LIMIT 1", sql)
+
+			sql, err = underTest.buildSelect("products", "name", v, v, 10)
+			is.NoErr(err)
+			is.Equal("SELECT * FROM `products` WHERE ((`name` > "+escaped[i]+") AND (`name` <= "+escaped[i]+")) ORDER BY `name` ASC LIMIT 10", sql)
+
+			sql, err = underTest.buildSoftDeleted("products", "deleted", "deleted_at", "name", v, v, v, 10)
+			is.NoErr(err)
+			is.Equal("SELECT * FROM `products` WHERE ((`deleted` IS TRUE) AND (`deleted_at` IS NOT NULL) AND (`name` <= "+escaped[i]+") "+
+				"AND ((`deleted_at` > "+escaped[i]+") OR ((`deleted_at` = "+escaped[i]+") AND (`name` > "+escaped[i]+")))) "+
+				"ORDER BY `deleted_at` ASC, `name` ASC LIMIT 10", sql)
+
+			is.Equal("SHOW VIEWS LIKE "+escaped[i], underTest.showViews(v))
+			is.Equal("REMOVE "+escaped[i], underTest.removeFile(v))
+		})
+	}
+}
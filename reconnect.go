@@ -0,0 +1,103 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// reconnectBackoff is the wait before the first reconnection attempt,
+// it doubles with every further attempt.
+var reconnectBackoff = time.Second
+
+// connect opens the database and configures its connection pool.
+func (c *sqlClient) connect(config Config) (*sql.DB, error) {
+	db, err := c.openDB(config)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(config.MaxOpenConns)
+	db.SetMaxIdleConns(config.MaxIdleConns)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
+
+	return db, nil
+}
+
+// withReconnect returns a writeFunc which reconnects to the warehouse and
+// retries the write, when the write fails because the connection broke.
+func (c *sqlClient) withReconnect(write writeFunc) writeFunc {
+	return func(ctx context.Context, record opencdc.Record) error {
+		return c.reconnectOnError(ctx, func(ctx context.Context) error {
+			return write(ctx, record)
+		})
+	}
+}
+
+// reconnectOnError runs op and, as long as it fails because the connection
+// broke, reconnects and runs it again, up to reconnectAttempts times.
+// Non-idempotent writes are only run again if the connection broke
+// before the statement was sent.
+func (c *sqlClient) reconnectOnError(ctx context.Context, op func(context.Context) error) error {
+	err := op(ctx)
+	for attempt := 0; attempt < c.config.ReconnectAttempts && err != nil && isConnectionError(err) && mayRetry(ctx, err); attempt++ {
+		wait := reconnectBackoff << attempt
+		sdk.Logger(ctx).Warn().Err(err).
+			Int("attempt", attempt+1).
+			Dur("wait", wait).
+			Msg("connection to the warehouse broke, reconnecting")
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-time.After(wait):
+		}
+		if reconnectErr := c.reconnect(ctx); reconnectErr != nil {
+			return fmt.Errorf("unable to reconnect: %w (write error: %w)", reconnectErr, err)
+		}
+		err = op(ctx)
+	}
+
+	return err
+}
+
+// reconnect replaces the connection pool with a new one.
+func (c *sqlClient) reconnect(ctx context.Context) error {
+	db, err := c.connect(c.config)
+	if err != nil {
+		return err
+	}
+
+	old := c.db
+	c.db = db
+	if old != nil {
+		_ = old.Close()
+	}
+	if err := c.ping(ctx); err != nil {
+		return err
+	}
+
+	c.reconnects++
+	sdk.Logger(ctx).Info().
+		Int("reconnects", c.reconnects).
+		Msg("reconnected to the warehouse")
+
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+type nonIdempotentKey struct{}
+
+// withNonIdempotentWrite returns a context which marks the write as not
+// idempotent, so that it isn't retried after errors which leave it open
+// whether the statement has been executed, like timeouts.
+func withNonIdempotentWrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nonIdempotentKey{}, true)
+}
+
+func nonIdempotentWrite(ctx context.Context) bool {
+	v, _ := ctx.Value(nonIdempotentKey{}).(bool)
+	return v
+}
+
+// mayRetry returns true if an operation which failed with err may be run
+// again. Executing a non-idempotent write twice could write its rows twice,
+// so it's only retried if it has surely not been executed.
+func mayRetry(ctx context.Context, err error) bool {
+	return !nonIdempotentWrite(ctx) || !isAmbiguousError(err)
+}
+
+// withRetry returns a writeFunc which retries the write with exponential
+// backoff, as long as it fails with a transient error, up to maxRetries times.
+func (c *sqlClient) withRetry(write writeFunc) writeFunc {
+	return func(ctx context.Context, record opencdc.Record) error {
+		return c.retryOnError(ctx, func(ctx context.Context) error {
+			return write(ctx, record)
+		})
+	}
+}
+
+// retryOnError runs op and, as long as it fails with a transient error,
+// runs it again after a backoff, up to maxRetries times. The backoff starts
+// at retryBackoff and doubles with every retry. Once the retries are
+// exhausted, the last error is returned. Non-idempotent writes aren't
+// retried after ambiguous errors.
+func (c *sqlClient) retryOnError(ctx context.Context, op func(context.Context) error) error {
+	err := op(ctx)
+	for attempt := 0; attempt < c.config.MaxRetries && err != nil && isTransientError(err) && mayRetry(ctx, err); attempt++ {
+		wait := c.config.RetryBackoff << attempt
+		sdk.Logger(ctx).Debug().Err(err).
+			Int("attempt", attempt+1).
+			Dur("wait", wait).
+			Msg("write failed with a transient error, retrying")
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-time.After(wait):
+		}
+		err = op(ctx)
+	}
+
+	return err
+}
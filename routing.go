@@ -0,0 +1,169 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+type tableKey struct{}
+
+// withTable returns a context which makes writes go to table,
+// instead of the table the client was opened with.
+func withTable(ctx context.Context, table string) context.Context {
+	return context.WithValue(ctx, tableKey{}, table)
+}
+
+func tableFromContext(ctx context.Context) string {
+	v, _ := ctx.Value(tableKey{}).(string)
+	return v
+}
+
+// withTable returns a copy of the configuration which writes to table.
+// If table is set, table replaces it within the catalog and schema,
+// otherwise it replaces tableName.
+func (c Config) withTable(table string) Config {
+	if c.Table != "" {
+		c.Table = table
+	} else {
+		c.TableName = table
+	}
+
+	return c
+}
+
+// parseTableTemplate parses tableNameTemplate, if it's set.
+func (d *Destination) parseTableTemplate() error {
+	d.tableTemplate = nil
+	if d.config.TableNameTemplate == "" {
+		return nil
+	}
+
+	t, err := template.New(ConfigTableNameTemplate).Parse(d.config.TableNameTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid %v: %w", ConfigTableNameTemplate, err)
+	}
+	d.tableTemplate = t
+
+	return nil
+}
+
+// recordTable returns the table to which record is routed through its
+// metadata or the table name template, or an empty string if it's written
+// to the default table.
+func (d *Destination) recordTable(record opencdc.Record) (string, error) {
+	if d.tableTemplate != nil {
+		var b bytes.Buffer
+		if err := d.tableTemplate.Execute(&b, record); err != nil {
+			return "", fmt.Errorf("failed rendering %v: %w", ConfigTableNameTemplate, err)
+		}
+		return sanitizeTableName(b.String())
+	}
+	if d.config.TableMetadataKey == "" {
+		return "", nil
+	}
+
+	// the table replaces the quoted table segment, if table is configured
+	table := record.Metadata[d.config.TableMetadataKey]
+	if table != "" && d.config.Table == "" {
+		if err := validateTableName(table); err != nil {
+			return "", fmt.Errorf("invalid table in metadata key %v: %w", d.config.TableMetadataKey, err)
+		}
+	}
+
+	return table, nil
+}
+
+// withRecordTable returns a context which makes the write
+// of record go to the table it's routed to, if any.
+func (d *Destination) withRecordTable(ctx context.Context, record opencdc.Record) (context.Context, error) {
+	table, err := d.recordTable(record)
+	if err != nil {
+		return ctx, err
+	}
+	if table != "" {
+		return withTable(ctx, table), nil
+	}
+
+	return ctx, nil
+}
+
+// sanitizeTableName makes a table name rendered from record data safe to use
+// in statements, by replacing every character other than letters, digits and
+// underscores in the dot-separated segments with an underscore.
+func sanitizeTableName(name string) (string, error) {
+	segments := strings.Split(strings.TrimSpace(name), ".")
+	for i, s := range segments {
+		if s == "" {
+			return "", fmt.Errorf("rendered table name %q has an empty segment", name)
+		}
+		segments[i] = strings.Map(func(r rune) rune {
+			if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+				return r
+			}
+			return '_'
+		}, s)
+	}
+
+	return strings.Join(segments, "."), nil
+}
+
+// forTable returns the client which writes to the table in ctx. A client
+// for a table other than the one c was opened with is opened when the
+// table is first written to and kept, so the column information of every
+// table is only read once. Each of these clients has its own connection
+// pool.
+func (c *sqlClient) forTable(ctx context.Context) (*sqlClient, error) {
+	table := tableFromContext(ctx)
+	if table == "" {
+		return c, nil
+	}
+	config := c.config.withTable(table)
+	name := config.qualifiedTableName()
+	if name == c.tableName {
+		return c, nil
+	}
+
+	c.tablesMu.Lock()
+	defer c.tablesMu.Unlock()
+
+	if t, ok := c.tables[name]; ok {
+		return t, nil
+	}
+
+	sdk.Logger(ctx).Info().Str("table", name).Msg("opening client for routed table")
+	t := &sqlClient{
+		queryBuilder: c.queryBuilder,
+		openDB:       c.openDB,
+		encryptors:   c.encryptors,
+	}
+	if err := t.Open(ctx, config); err != nil {
+		_ = t.Close()
+		return nil, fmt.Errorf("unable to open table %v: %w", name, err)
+	}
+	if c.tables == nil {
+		c.tables = make(map[string]*sqlClient)
+	}
+	c.tables[name] = t
+
+	return t, nil
+}
@@ -0,0 +1,88 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// columnExistsMarkers are substrings of Databricks error messages returned
+// when a column which is added already exists.
+var columnExistsMarkers = []string{
+	"FIELDS_ALREADY_EXISTS",
+	"FIELD_ALREADY_EXISTS",
+	"already exists",
+}
+
+// withAutoAddColumns returns a writeFunc which, if autoAddColumns is enabled,
+// adds the columns missing for the fields of the record before writing it.
+func (c *sqlClient) withAutoAddColumns(write writeFunc) writeFunc {
+	return func(ctx context.Context, record opencdc.Record) error {
+		if err := c.addMissingColumns(ctx, record); err != nil {
+			return err
+		}
+
+		return write(ctx, record)
+	}
+}
+
+// addMissingColumns adds the columns for the fields of records which the
+// table doesn't have, with types inferred from their values, and refreshes
+// the column information. Columns added in the meantime by another writer
+// are not an error.
+func (c *sqlClient) addMissingColumns(ctx context.Context, records ...opencdc.Record) error {
+	if !c.config.AutoAddColumns {
+		return nil
+	}
+
+	// writers sharing the client add columns one at a time, so a column
+	// missing for several of them is only added once
+	c.schemaMu.Lock()
+	defer c.schemaMu.Unlock()
+
+	columns, types, err := c.inferColumns(ctx, records...)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, col := range columns {
+		if !c.hasColumn(col) {
+			missing = append(missing, col)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	sqlString := c.queryBuilder.addColumns(c.tableName, missing, types)
+	sdk.Logger(ctx).Info().Strs("columns", missing).Msgf("adding columns\n%v\n", sqlString)
+	if _, err := c.execContext(ctx, sqlString); err != nil {
+		if !containsAny(err.Error(), columnExistsMarkers) {
+			return fmt.Errorf("failed adding columns: %w", classifyError(err))
+		}
+		sdk.Logger(ctx).Debug().Err(err).Msg("columns have already been added")
+	}
+
+	if err := c.refreshColumns(ctx); err != nil {
+		return fmt.Errorf("unable to refresh column information: %w", err)
+	}
+
+	return nil
+}
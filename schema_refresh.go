@@ -0,0 +1,120 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// columnType returns the type of col, or an empty
+// string if the table has no such column.
+func (c *sqlClient) columnType(col string) string {
+	c.columnsMu.RLock()
+	defer c.columnsMu.RUnlock()
+
+	return c.columnTypes[c.canonicalColumnLocked(col)]
+}
+
+// hasColumn returns true if the table has the column col,
+// ignoring case.
+func (c *sqlClient) hasColumn(col string) bool {
+	c.columnsMu.RLock()
+	defer c.columnsMu.RUnlock()
+
+	_, ok := c.columnTypes[c.canonicalColumnLocked(col)]
+	return ok
+}
+
+// canonicalColumn returns the name of the table column matching col
+// case-insensitively, as it is spelled in the table. If the table has
+// no such column, col is returned unchanged.
+func (c *sqlClient) canonicalColumn(col string) string {
+	c.columnsMu.RLock()
+	defer c.columnsMu.RUnlock()
+
+	return c.canonicalColumnLocked(col)
+}
+
+func (c *sqlClient) canonicalColumnLocked(col string) string {
+	if _, ok := c.columnTypes[col]; ok {
+		return col
+	}
+	if canonical, ok := c.columnsByLower[strings.ToLower(col)]; ok {
+		return canonical
+	}
+	return col
+}
+
+// columnNames returns the columns of the table, in table order.
+func (c *sqlClient) columnNames() []string {
+	c.columnsMu.RLock()
+	defer c.columnsMu.RUnlock()
+
+	return c.columns
+}
+
+// refreshColumns reads the column information of the table again,
+// e.g. after the table schema changed.
+func (c *sqlClient) refreshColumns(ctx context.Context) error {
+	sdk.Logger(ctx).Debug().Msg("refreshing column information")
+	c.refreshDue.Store(false)
+
+	return c.getColumnInfo(ctx)
+}
+
+// startSchemaRefresh makes the column information refresh every
+// schemaRefreshInterval. The ticker only marks the refresh as due, the
+// refresh itself is done with the next write, so it never uses the
+// connection concurrently with a write.
+func (c *sqlClient) startSchemaRefresh() {
+	if c.config.SchemaRefreshInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.config.SchemaRefreshInterval)
+	done := make(chan struct{})
+	c.stopSchemaRefresh = func() {
+		ticker.Stop()
+		close(done)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				c.refreshDue.Store(true)
+			}
+		}
+	}()
+}
+
+// refreshColumnsIfDue refreshes the column information, if the periodic
+// refresh is due. A failed refresh is logged, the cached column
+// information is used until the next one.
+func (c *sqlClient) refreshColumnsIfDue(ctx context.Context) {
+	if !c.refreshDue.Load() {
+		return
+	}
+
+	if err := c.refreshColumns(ctx); err != nil {
+		sdk.Logger(ctx).Warn().Err(err).Msg("periodic refresh of column information failed")
+	}
+}
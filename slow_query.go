@@ -0,0 +1,57 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// valueClauses start the parts of statements which contain values.
+var valueClauses = []string{" VALUES ", " SET ", " WHERE ", " USING "}
+
+// logIfSlow logs the statement at warn level, if it took longer than the
+// slow query threshold since start.
+func (c *sqlClient) logIfSlow(ctx context.Context, sqlString string, start time.Time) {
+	if c.config.SlowQueryThreshold <= 0 {
+		return
+	}
+	elapsed := time.Since(start)
+	if elapsed <= c.config.SlowQueryThreshold {
+		return
+	}
+
+	sdk.Logger(ctx).Warn().
+		Dur("elapsed", elapsed).
+		Dur("threshold", c.config.SlowQueryThreshold).
+		Str("sql", c.loggedSQL(withoutValues(sqlString))).
+		Msg("slow query")
+}
+
+// withoutValues returns the start of sqlString up to the first clause
+// containing values, so no record data ends up in the log.
+func withoutValues(sqlString string) string {
+	end := len(sqlString)
+	for _, clause := range valueClauses {
+		if i := strings.Index(sqlString, clause); i >= 0 && i < end {
+			end = i
+		}
+	}
+
+	return sqlString[:end]
+}
@@ -0,0 +1,71 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"fmt"
+	"strings"
+)
+
+// softDeleteValue returns the SQL expression the soft delete column is set
+// to. Unless one is configured, boolean columns are set to true and
+// timestamp columns to the current timestamp.
+func (c *sqlClient) softDeleteValue() (string, error) {
+	if c.config.SoftDeleteValue != "" {
+		return c.config.SoftDeleteValue, nil
+	}
+
+	dataType := c.columnType(c.config.SoftDeleteColumn)
+	switch {
+	case strings.EqualFold(dataType, "boolean"):
+		return "true", nil
+	case isTimestampType(dataType):
+		return "current_timestamp()", nil
+	default:
+		return "", fmt.Errorf(
+			"%v is required for soft delete column %q of type %v",
+			ConfigSoftDeleteValue, c.config.SoftDeleteColumn, dataType,
+		)
+	}
+}
+
+// buildDelete builds the statement deleting the row with key, which
+// updates the soft delete column instead, if one is configured.
+func (c *sqlClient) buildDelete(key recordKey) (string, error) {
+	if c.config.SoftDeleteColumn == "" {
+		return c.queryBuilder.buildDelete(c.tableName, key)
+	}
+
+	value, err := c.softDeleteValue()
+	if err != nil {
+		return "", err
+	}
+
+	return c.queryBuilder.buildSoftDelete(c.tableName, key, c.config.SoftDeleteColumn, value)
+}
+
+// checkSoftDeleteColumn checks that the soft delete column, if one is
+// configured, exists and that the value it's set to is known.
+func (c *sqlClient) checkSoftDeleteColumn() error {
+	if c.config.SoftDeleteColumn == "" {
+		return nil
+	}
+	if !c.hasColumn(c.config.SoftDeleteColumn) {
+		return fmt.Errorf("soft delete column %q not found in table %v", c.config.SoftDeleteColumn, c.tableName)
+	}
+
+	_, err := c.softDeleteValue()
+	return err
+}
@@ -0,0 +1,443 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+//go:generate paramgen -output=paramgen_src.go SourceConfig
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/conduitio/conduit-commons/config"
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+type SourceConfig struct {
+	// Personal access token.
+	Token string `json:"token" validate:"required"`
+	// Databricks server hostname. A workspace URL is accepted too, its
+	// scheme and path are stripped.
+	Host string `json:"host" validate:"required"`
+	// Databricks port
+	Port int `json:"port" default:"443"`
+	// Databricks compute resources URL.
+	HTTPath string `json:"httpPath" validate:"required"`
+	// Table from which records are read.
+	TableName string `json:"tableName" validate:"required"`
+	// How rows are read. "polling" reads rows in order of the ordering
+	// column. "changeDataFeed" reads inserts, updates and deletes from
+	// the change data feed of the table, which needs to be enabled.
+	ReadMode string `json:"readMode" default:"polling" validate:"inclusion=polling|changeDataFeed"`
+	// Column by which rows are ordered. Its values need to be unique and
+	// increasing, rows are read in order of this column and the last read
+	// value is tracked in the position. Required when polling. When reading
+	// the change data feed, it's used as the record key and orders the
+	// changes within a version, if set. Without it, a version which has
+	// been read partially is read again as a whole after a restart.
+	OrderingColumn string `json:"orderingColumn"`
+	// Boolean column flagging soft-deleted rows. When polling, rows with the
+	// flag set are emitted as delete records, including rows which are
+	// flagged after they were read. Requires softDeleteWatermarkColumn.
+	SoftDeleteColumn string `json:"softDeleteColumn"`
+	// Column which is set to an increasing value whenever a row is flagged
+	// in softDeleteColumn, e.g. a deleted_at or updated_at timestamp.
+	// Flagged rows are emitted as delete records in order of this column,
+	// and the value of the last emitted row is kept in the position, so
+	// every deleted row is emitted once.
+	SoftDeleteWatermarkColumn string `json:"softDeleteWatermarkColumn"`
+	// Maximum number of rows fetched with a single query.
+	BatchSize int `json:"batchSize" default:"100" validate:"gt=0"`
+	// Maximum number of rows fetched with a single query during the
+	// snapshot. The snapshot is paged by the ordering column, so memory
+	// stays bounded regardless of the table size. Zero uses batchSize.
+	SnapshotFetchSize int `json:"snapshotFetchSize" default:"0"`
+}
+
+// Modes of the source. The source takes a snapshot of the table when it's
+// started without a position, then reads rows incrementally.
+const (
+	sourceModeSnapshot    = "snapshot"
+	sourceModeIncremental = "incremental"
+	// sourceModeChangeDataFeed is the mode of positions in the change data feed.
+	sourceModeChangeDataFeed = "changeDataFeed"
+)
+
+// Read modes of the source, as configured in readMode.
+const (
+	// readModePolling reads rows in order of the ordering column.
+	readModePolling = "polling"
+	// readModeChangeDataFeed reads the change data feed of the table.
+	readModeChangeDataFeed = "changeDataFeed"
+)
+
+// sourcePosition is the position of a record read by the source.
+type sourcePosition struct {
+	// Mode is the mode in which the record was read. Positions without
+	// a mode are incremental.
+	Mode string `json:"mode,omitempty"`
+	// LastValue is the value of the ordering column of the record.
+	LastValue interface{} `json:"lastValue,omitempty"`
+	// SnapshotEnd is the greatest value of the ordering column when the
+	// snapshot started. Rows up to it are part of the snapshot.
+	SnapshotEnd interface{} `json:"snapshotEnd,omitempty"`
+	// Version is the table version from which the change data feed
+	// is read next.
+	Version int64 `json:"version,omitempty"`
+	// Offset is the number of changes of Version which have been read.
+	// It's only tracked if the changes are ordered by the ordering column.
+	Offset int `json:"offset,omitempty"`
+	// DeletedUntil is the value of the soft delete watermark column of
+	// the last soft-deleted row emitted as a delete record.
+	DeletedUntil interface{} `json:"deletedUntil,omitempty"`
+	// DeletedLastValue is the value of the ordering column of that row,
+	// which orders rows with the same watermark value.
+	DeletedLastValue interface{} `json:"deletedLastValue,omitempty"`
+}
+
+func (p sourcePosition) toSDK() (opencdc.Position, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed marshalling position: %w", err)
+	}
+
+	return b, nil
+}
+
+// parseSourcePosition parses a position created by the source. Integers are
+// decoded as int64, so that big integers don't lose precision.
+func parseSourcePosition(position opencdc.Position) (sourcePosition, error) {
+	var p sourcePosition
+	if len(position) == 0 {
+		return p, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(position))
+	dec.UseNumber()
+	if err := dec.Decode(&p); err != nil {
+		return sourcePosition{}, fmt.Errorf("invalid position: %w", err)
+	}
+	p.LastValue = fromJSONNumber(p.LastValue)
+	p.SnapshotEnd = fromJSONNumber(p.SnapshotEnd)
+	p.DeletedUntil = fromJSONNumber(p.DeletedUntil)
+	p.DeletedLastValue = fromJSONNumber(p.DeletedLastValue)
+
+	return p, nil
+}
+
+// fromJSONNumber converts v to an int64 or float64, if it's a json.Number.
+func fromJSONNumber(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+
+	return v
+}
+
+type Source struct {
+	sdk.UnimplementedSource
+
+	config       SourceConfig
+	db           *sql.DB
+	queryBuilder queryBuilder
+
+	// position is the position of the last fetched row
+	position sourcePosition
+	// buffer holds the fetched records which haven't been read yet
+	buffer []opencdc.Record
+}
+
+func NewSource() sdk.Source {
+	return sdk.SourceWithMiddleware(
+		&Source{queryBuilder: &ansiQueryBuilder{}},
+	)
+}
+
+func (s *Source) Parameters() config.Parameters {
+	return s.config.Parameters()
+}
+
+func (s *Source) Configure(ctx context.Context, cfg config.Config) error {
+	sdk.Logger(ctx).Info().Msg("Configuring Source...")
+	err := sdk.Util.ParseConfig(ctx, cfg, &s.config, NewSource().Parameters())
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	s.config.Host, err = normalizeHost(ctx, s.config.Host)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if err := validateTableName(s.config.TableName); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if s.config.ReadMode == readModePolling && s.config.OrderingColumn == "" {
+		return fmt.Errorf("invalid config: %q is required when polling", SourceConfigOrderingColumn)
+	}
+	if s.config.ReadMode != readModePolling && s.config.SoftDeleteColumn != "" {
+		return fmt.Errorf("invalid config: %q is only supported when polling", SourceConfigSoftDeleteColumn)
+	}
+	if s.config.SoftDeleteColumn != "" && s.config.SoftDeleteWatermarkColumn == "" {
+		return fmt.Errorf("invalid config: %q is required with %q", SourceConfigSoftDeleteWatermarkColumn, SourceConfigSoftDeleteColumn)
+	}
+
+	return nil
+}
+
+func (s *Source) Open(ctx context.Context, position opencdc.Position) error {
+	sdk.Logger(ctx).Info().Msg("opening the source")
+
+	p, err := parseSourcePosition(position)
+	if err != nil {
+		return err
+	}
+	s.position = p
+
+	db, err := openDB(Config{
+		Token:                   s.config.Token,
+		Host:                    s.config.Host,
+		Port:                    s.config.Port,
+		HTTPath:                 s.config.HTTPath,
+		AllowWarehouseAutostart: true,
+	})
+	if err != nil {
+		return err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+	s.db = db
+
+	if s.config.ReadMode == readModeChangeDataFeed {
+		return s.openChangeDataFeed(ctx, len(position) == 0)
+	}
+	if len(position) == 0 {
+		return s.startSnapshot(ctx)
+	}
+
+	return nil
+}
+
+// startSnapshot starts a snapshot of the rows currently in the table.
+// If the table is empty, there's nothing to snapshot and the source
+// reads rows incrementally right away.
+func (s *Source) startSnapshot(ctx context.Context) error {
+	sqlString, err := s.queryBuilder.buildMaxValue(s.config.TableName, s.config.OrderingColumn)
+	if err != nil {
+		return fmt.Errorf("failed building max value query: %w", err)
+	}
+
+	var snapshotEnd interface{}
+	err = s.db.QueryRowContext(ctx, sqlString).Scan(&snapshotEnd)
+	if err != nil {
+		return fmt.Errorf("failed getting snapshot end: %w", classifyError(err))
+	}
+	if b, ok := snapshotEnd.([]byte); ok {
+		snapshotEnd = string(b)
+	}
+
+	if snapshotEnd == nil {
+		sdk.Logger(ctx).Info().Msg("table is empty, skipping snapshot")
+		s.position = sourcePosition{Mode: sourceModeIncremental}
+		return nil
+	}
+
+	sdk.Logger(ctx).Info().Interface("snapshot_end", snapshotEnd).Msg("starting snapshot")
+	s.position = sourcePosition{Mode: sourceModeSnapshot, SnapshotEnd: snapshotEnd}
+
+	return nil
+}
+
+func (s *Source) Read(ctx context.Context) (opencdc.Record, error) {
+	if len(s.buffer) == 0 {
+		fetch := s.fetch
+		if s.config.ReadMode == readModeChangeDataFeed {
+			fetch = s.fetchChanges
+		}
+		records, err := fetch(ctx)
+		if err != nil {
+			return opencdc.Record{}, err
+		}
+		if len(records) == 0 && s.config.SoftDeleteColumn != "" && s.position.Mode != sourceModeSnapshot {
+			records, err = s.fetchSoftDeleted(ctx)
+			if err != nil {
+				return opencdc.Record{}, err
+			}
+		}
+		if len(records) == 0 {
+			return opencdc.Record{}, sdk.ErrBackoffRetry
+		}
+		s.buffer = records
+	}
+
+	record := s.buffer[0]
+	s.buffer = s.buffer[1:]
+
+	return record, nil
+}
+
+// fetch selects the next batch of rows after the last fetched value.
+// During the snapshot, only rows up to the snapshot end are selected.
+// The snapshot is complete once a batch isn't full, in which case
+// the position of the last record switches to the incremental mode.
+func (s *Source) fetch(ctx context.Context) ([]opencdc.Record, error) {
+	snapshot := s.position.Mode == sourceModeSnapshot
+
+	var upperBound interface{}
+	limit := s.config.BatchSize
+	if snapshot {
+		upperBound = s.position.SnapshotEnd
+		if s.config.SnapshotFetchSize > 0 {
+			limit = s.config.SnapshotFetchSize
+		}
+	}
+	sqlString, err := s.queryBuilder.buildSelect(
+		s.config.TableName,
+		s.config.OrderingColumn,
+		s.position.LastValue,
+		upperBound,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed building select query: %w", err)
+	}
+	sdk.Logger(ctx).Trace().Msgf("select sql string\n%v\n", sqlString)
+
+	payloads, err := s.query(ctx, sqlString)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotDone := snapshot && len(payloads) < limit
+	if snapshotDone {
+		sdk.Logger(ctx).Info().Msg("snapshot completed, switching to incremental reads")
+	}
+
+	records := make([]opencdc.Record, 0, len(payloads))
+	for i, payload := range payloads {
+		orderingValue, ok := payload[s.config.OrderingColumn]
+		if !ok {
+			return nil, fmt.Errorf("ordering column %q not found in table", s.config.OrderingColumn)
+		}
+
+		s.position.LastValue = orderingValue
+		if snapshotDone && i == len(payloads)-1 {
+			s.position.Mode = sourceModeIncremental
+			s.position.SnapshotEnd = nil
+		}
+		// soft-deleted rows are emitted as delete records in order of
+		// the watermark column, once they've been read
+		if s.isSoftDeleted(payload) {
+			continue
+		}
+		record, err := s.toRecord(payload, orderingValue, snapshot)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	if snapshotDone && len(payloads) == 0 {
+		s.position.Mode = sourceModeIncremental
+		s.position.SnapshotEnd = nil
+	}
+
+	return records, nil
+}
+
+// query executes sqlString and returns the selected rows.
+func (s *Source) query(ctx context.Context, sqlString string) ([]opencdc.StructuredData, error) {
+	rows, err := s.db.QueryContext(ctx, sqlString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", classifyError(err))
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed getting columns: %w", err)
+	}
+
+	var payloads []opencdc.StructuredData
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to next(): %w", err)
+		}
+
+		payload := make(opencdc.StructuredData, len(columns))
+		for i, col := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			payload[col] = values[i]
+		}
+		payloads = append(payloads, payload)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading rows: %w", err)
+	}
+
+	return payloads, nil
+}
+
+// toRecord creates a record for a row, positioned at the current position.
+// Rows read during the snapshot are snapshot records.
+func (s *Source) toRecord(payload opencdc.StructuredData, orderingValue interface{}, snapshot bool) (opencdc.Record, error) {
+	softDeleted := s.isSoftDeleted(payload)
+
+	position, err := s.position.toSDK()
+	if err != nil {
+		return opencdc.Record{}, err
+	}
+
+	metadata := opencdc.Metadata{}
+	metadata.SetCollection(s.config.TableName)
+	key := opencdc.StructuredData{s.config.OrderingColumn: orderingValue}
+
+	if softDeleted {
+		return sdk.Util.Source.NewRecordDelete(position, metadata, key, payload), nil
+	}
+	if snapshot {
+		return sdk.Util.Source.NewRecordSnapshot(position, metadata, key, payload), nil
+	}
+
+	return sdk.Util.Source.NewRecordCreate(position, metadata, key, payload), nil
+}
+
+func (s *Source) Ack(ctx context.Context, position opencdc.Position) error {
+	sdk.Logger(ctx).Trace().Str("position", string(position)).Msg("got ack")
+	return nil
+}
+
+func (s *Source) Teardown(ctx context.Context) error {
+	sdk.Logger(ctx).Info().Msg("tearing down the source")
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// Columns added to the rows of the change data feed.
+const (
+	changeTypeColumn      = "_change_type"
+	commitVersionColumn   = "_commit_version"
+	commitTimestampColumn = "_commit_timestamp"
+)
+
+// Metadata keys of records read from the change data feed.
+const (
+	metadataCommitVersion   = "databricks.commitVersion"
+	metadataCommitTimestamp = "databricks.commitTimestamp"
+)
+
+// changeOperations maps the change types of the change data feed to
+// operations. Pre-images of updates are skipped, the post-image
+// holds the updated row.
+var changeOperations = map[string]opencdc.Operation{
+	"insert":           opencdc.OperationCreate,
+	"update_postimage": opencdc.OperationUpdate,
+	"delete":           opencdc.OperationDelete,
+}
+
+// openChangeDataFeed checks that the change data feed is enabled on the
+// table. Without a position, reading starts with the changes committed
+// after the latest version.
+func (s *Source) openChangeDataFeed(ctx context.Context, start bool) error {
+	rows, err := s.query(ctx, s.queryBuilder.showChangeDataFeed(s.config.TableName))
+	if err != nil {
+		return fmt.Errorf("failed getting table properties: %w", err)
+	}
+	if len(rows) == 0 || fmt.Sprint(rows[0]["value"]) != "true" {
+		return fmt.Errorf(
+			"%w on table %v, enable it with ALTER TABLE %v SET TBLPROPERTIES (delta.enableChangeDataFeed = true)",
+			ErrChangeDataFeedDisabled, s.config.TableName, s.config.TableName,
+		)
+	}
+
+	if !start {
+		return nil
+	}
+	latest, err := s.latestVersion(ctx)
+	if err != nil {
+		return err
+	}
+	s.position = sourcePosition{Mode: sourceModeChangeDataFeed, Version: latest + 1}
+	sdk.Logger(ctx).Info().Int64("version", s.position.Version).Msg("reading change data feed")
+
+	return nil
+}
+
+// latestVersion returns the latest version of the table.
+func (s *Source) latestVersion(ctx context.Context) (int64, error) {
+	rows, err := s.query(ctx, s.queryBuilder.describeHistory(s.config.TableName))
+	if err != nil {
+		return 0, fmt.Errorf("failed getting table history: %w", err)
+	}
+	if len(rows) == 0 {
+		return 0, fmt.Errorf("table %v has no history", s.config.TableName)
+	}
+	version, ok := toInt64(rows[0]["version"])
+	if !ok {
+		return 0, fmt.Errorf("unexpected table version %v", rows[0]["version"])
+	}
+
+	return version, nil
+}
+
+// fetchChanges reads the changes of the next table version which has any,
+// a version at a time. The changes of a version which have already been
+// read, as recorded in the position, are skipped. Without an ordering
+// column, the order of the changes within a version isn't stable, so the
+// position only advances at the end of a version, and a version which
+// has been read partially is read again as a whole.
+func (s *Source) fetchChanges(ctx context.Context) ([]opencdc.Record, error) {
+	latest, err := s.latestVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for s.position.Version <= latest {
+		sqlString, err := s.queryBuilder.buildTableChanges(s.config.TableName, s.config.OrderingColumn, s.position.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed building table changes query: %w", err)
+		}
+		sdk.Logger(ctx).Trace().Msgf("table changes sql string\n%v\n", sqlString)
+
+		changes, err := s.query(ctx, sqlString)
+		if err != nil {
+			return nil, err
+		}
+
+		var records []opencdc.Record
+		for i := s.position.Offset; i < len(changes); i++ {
+			if i == len(changes)-1 {
+				s.position = sourcePosition{Mode: sourceModeChangeDataFeed, Version: s.position.Version + 1}
+			} else if s.config.OrderingColumn != "" {
+				s.position.Offset = i + 1
+			}
+
+			record, ok, err := s.changeRecord(changes[i])
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				records = append(records, record)
+			}
+		}
+		if len(changes) <= s.position.Offset {
+			// the version has no changes left, e.g. it's an OPTIMIZE commit
+			s.position = sourcePosition{Mode: sourceModeChangeDataFeed, Version: s.position.Version + 1}
+		}
+		if len(records) > 0 {
+			return records, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// changeRecord creates a record for a row of the change data feed,
+// positioned at the current position. Rows which don't map to an operation
+// are skipped.
+func (s *Source) changeRecord(row opencdc.StructuredData) (opencdc.Record, bool, error) {
+	changeType := fmt.Sprint(row[changeTypeColumn])
+	op, ok := changeOperations[changeType]
+	if !ok {
+		if changeType != "update_preimage" {
+			return opencdc.Record{}, false, fmt.Errorf("unknown change type %q", changeType)
+		}
+		return opencdc.Record{}, false, nil
+	}
+
+	metadata := opencdc.Metadata{
+		metadataCommitVersion:   fmt.Sprint(row[commitVersionColumn]),
+		metadataCommitTimestamp: fmt.Sprint(row[commitTimestampColumn]),
+	}
+	metadata.SetCollection(s.config.TableName)
+
+	payload := make(opencdc.StructuredData, len(row))
+	for col, v := range row {
+		switch col {
+		case changeTypeColumn, commitVersionColumn, commitTimestampColumn:
+		default:
+			payload[col] = v
+		}
+	}
+
+	var key opencdc.Data
+	if s.config.OrderingColumn != "" {
+		key = opencdc.StructuredData{s.config.OrderingColumn: payload[s.config.OrderingColumn]}
+	}
+
+	position, err := s.position.toSDK()
+	if err != nil {
+		return opencdc.Record{}, false, err
+	}
+
+	switch op {
+	case opencdc.OperationUpdate:
+		return sdk.Util.Source.NewRecordUpdate(position, metadata, key, nil, payload), true, nil
+	case opencdc.OperationDelete:
+		return sdk.Util.Source.NewRecordDelete(position, metadata, key, payload), true, nil
+	default:
+		return sdk.Util.Source.NewRecordCreate(position, metadata, key, payload), true, nil
+	}
+}
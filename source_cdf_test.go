@@ -0,0 +1,176 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+// newChangeDataFeedDB returns a fakeDB for a table with the change data feed
+// enabled as given, in its latest version 7. Version 6 has an insert and an
+// update, version 7 has a delete. The changes of version 6 are only returned
+// in a stable order, if they're ordered by the change type and id.
+func newChangeDataFeedDB(enabled string) *fakeDB {
+	return &fakeDB{
+		query: func(_ context.Context, query string) ([]string, [][]driver.Value, error) {
+			changeColumns := []string{"id", "name", "_change_type", "_commit_version", "_commit_timestamp"}
+			switch {
+			case strings.HasPrefix(query, "SHOW TBLPROPERTIES"):
+				return []string{"key", "value"}, [][]driver.Value{{"delta.enableChangeDataFeed", enabled}}, nil
+			case strings.HasPrefix(query, "DESCRIBE HISTORY"):
+				return []string{"version", "operation"}, [][]driver.Value{{int64(7), "DELETE"}}, nil
+			case strings.Contains(query, "table_changes('products', 6, 6) ORDER BY `_commit_version` ASC, `_change_type` ASC, `id` ASC"):
+				return changeColumns, [][]driver.Value{
+					{int64(1), "computer", "insert", int64(6), "2024-01-01 00:00:00"},
+					{int64(2), "tablet", "update_postimage", int64(6), "2024-01-01 00:00:00"},
+					{int64(2), "phone", "update_preimage", int64(6), "2024-01-01 00:00:00"},
+				}, nil
+			case strings.Contains(query, "table_changes('products', 6, 6)"):
+				return changeColumns, [][]driver.Value{
+					{int64(2), "phone", "update_preimage", int64(6), "2024-01-01 00:00:00"},
+					{int64(2), "tablet", "update_postimage", int64(6), "2024-01-01 00:00:00"},
+					{int64(1), "computer", "insert", int64(6), "2024-01-01 00:00:00"},
+				}, nil
+			case strings.Contains(query, "table_changes('products', 7, 7)"):
+				return changeColumns, [][]driver.Value{
+					{int64(1), "computer", "delete", int64(7), "2024-01-02 00:00:00"},
+				}, nil
+			default:
+				return nil, nil, errors.New("unexpected query: " + query)
+			}
+		},
+	}
+}
+
+func newTestChangeDataFeedSource(db *fakeDB) *Source {
+	s := newTestSource(db, 100)
+	s.config.ReadMode = readModeChangeDataFeed
+
+	return s
+}
+
+func TestSource_OpenChangeDataFeed(t *testing.T) {
+	is := is.New(t)
+
+	underTest := newTestChangeDataFeedSource(newChangeDataFeedDB("true"))
+	is.NoErr(underTest.openChangeDataFeed(context.Background(), true))
+
+	// reading starts with the changes after the latest version
+	is.Equal(sourcePosition{Mode: sourceModeChangeDataFeed, Version: 8}, underTest.position)
+}
+
+func TestSource_OpenChangeDataFeed_Disabled(t *testing.T) {
+	is := is.New(t)
+
+	underTest := newTestChangeDataFeedSource(newChangeDataFeedDB("false"))
+	err := underTest.openChangeDataFeed(context.Background(), true)
+	is.True(errors.Is(err, ErrChangeDataFeedDisabled))
+}
+
+func TestSource_Read_ChangeDataFeed(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	underTest := newTestChangeDataFeedSource(newChangeDataFeedDB("true"))
+	underTest.position = sourcePosition{Mode: sourceModeChangeDataFeed, Version: 6}
+
+	var got []opencdc.Record
+	for i := 0; i < 3; i++ {
+		r, err := underTest.Read(ctx)
+		is.NoErr(err)
+		got = append(got, r)
+	}
+	_, err := underTest.Read(ctx)
+	is.Equal(sdk.ErrBackoffRetry, err)
+
+	is.Equal(opencdc.OperationCreate, got[0].Operation)
+	is.Equal(opencdc.StructuredData{"id": int64(1), "name": "computer"}, got[0].Payload.After)
+	is.Equal(`{"mode":"changeDataFeed","version":6,"offset":1}`, string(got[0].Position))
+	is.Equal("6", got[0].Metadata[metadataCommitVersion])
+
+	// the pre-image is skipped
+	is.Equal(opencdc.OperationUpdate, got[1].Operation)
+	is.Equal(opencdc.StructuredData{"id": int64(2)}, got[1].Key)
+	is.Equal(opencdc.StructuredData{"id": int64(2), "name": "tablet"}, got[1].Payload.After)
+	is.Equal(`{"mode":"changeDataFeed","version":6,"offset":2}`, string(got[1].Position))
+
+	is.Equal(opencdc.OperationDelete, got[2].Operation)
+	is.Equal(opencdc.StructuredData{"id": int64(1), "name": "computer"}, got[2].Payload.Before)
+	is.Equal(`{"mode":"changeDataFeed","version":8}`, string(got[2].Position))
+}
+
+func TestSource_Read_ChangeDataFeedResume(t *testing.T) {
+	is := is.New(t)
+
+	underTest := newTestChangeDataFeedSource(newChangeDataFeedDB("true"))
+	p, err := parseSourcePosition(opencdc.Position(`{"mode":"changeDataFeed","version":6,"offset":1}`))
+	is.NoErr(err)
+	underTest.position = p
+
+	// the changes of version 6 which have been read are skipped
+	got, err := underTest.Read(context.Background())
+	is.NoErr(err)
+	is.Equal(opencdc.OperationUpdate, got.Operation)
+	is.Equal(opencdc.StructuredData{"id": int64(2), "name": "tablet"}, got.Payload.After)
+}
+
+func TestSource_Read_ChangeDataFeedResume_RemainingChanges(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	underTest := newTestChangeDataFeedSource(newChangeDataFeedDB("true"))
+	p, err := parseSourcePosition(opencdc.Position(`{"mode":"changeDataFeed","version":6,"offset":2}`))
+	is.NoErr(err)
+	underTest.position = p
+
+	// only the pre-image of version 6 is left, so reading continues
+	// with the changes of version 7
+	got, err := underTest.Read(ctx)
+	is.NoErr(err)
+	is.Equal(opencdc.OperationDelete, got.Operation)
+	is.Equal("7", got.Metadata[metadataCommitVersion])
+	_, err = underTest.Read(ctx)
+	is.Equal(sdk.ErrBackoffRetry, err)
+}
+
+func TestSource_Read_ChangeDataFeed_NoOrderingColumn(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	underTest := newTestChangeDataFeedSource(newChangeDataFeedDB("true"))
+	underTest.config.OrderingColumn = ""
+	underTest.position = sourcePosition{Mode: sourceModeChangeDataFeed, Version: 6}
+
+	// the changes aren't ordered, so the position of the changes within
+	// version 6 is the start of the version, which is read again as a whole
+	var positions []string
+	for i := 0; i < 2; i++ {
+		r, err := underTest.Read(ctx)
+		is.NoErr(err)
+		positions = append(positions, string(r.Position))
+	}
+	is.Equal([]string{
+		`{"mode":"changeDataFeed","version":6}`,
+		`{"mode":"changeDataFeed","version":7}`,
+	}, positions)
+}
@@ -0,0 +1,98 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// fetchSoftDeleted fetches the next batch of rows which have been read
+// before and are flagged in the soft delete column, in order of the
+// watermark column. Each of them is returned as a delete record once,
+// since the position tracks the watermark of the last returned row.
+func (s *Source) fetchSoftDeleted(ctx context.Context) ([]opencdc.Record, error) {
+	if s.position.LastValue == nil {
+		return nil, nil
+	}
+
+	sqlString, err := s.queryBuilder.buildSoftDeleted(
+		s.config.TableName,
+		s.config.SoftDeleteColumn,
+		s.config.SoftDeleteWatermarkColumn,
+		s.config.OrderingColumn,
+		s.position.LastValue,
+		s.position.DeletedUntil,
+		s.position.DeletedLastValue,
+		s.config.BatchSize,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed building soft delete query: %w", err)
+	}
+	sdk.Logger(ctx).Trace().Msgf("soft delete sql string\n%v\n", sqlString)
+
+	payloads, err := s.query(ctx, sqlString)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]opencdc.Record, len(payloads))
+	for i, payload := range payloads {
+		orderingValue, ok := payload[s.config.OrderingColumn]
+		if !ok {
+			return nil, fmt.Errorf("ordering column %q not found in table", s.config.OrderingColumn)
+		}
+		watermark, ok := payload[s.config.SoftDeleteWatermarkColumn]
+		if !ok {
+			return nil, fmt.Errorf("soft delete watermark column %q not found in table", s.config.SoftDeleteWatermarkColumn)
+		}
+
+		s.position.DeletedUntil = watermark
+		s.position.DeletedLastValue = orderingValue
+		records[i], err = s.toRecord(payload, orderingValue, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
+// isSoftDeleted returns true if the soft delete column of payload is set.
+func (s *Source) isSoftDeleted(payload opencdc.StructuredData) bool {
+	if s.config.SoftDeleteColumn == "" {
+		return false
+	}
+
+	switch v := payload[s.config.SoftDeleteColumn].(type) {
+	case bool:
+		return v
+	case string:
+		deleted, err := strconv.ParseBool(v)
+		return err == nil && deleted
+	case int64:
+		return v != 0
+	case int32:
+		return v != 0
+	case int:
+		return v != 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,375 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	sdk "github.com/conduitio/conduit-connector-sdk"
+	"github.com/matryer/is"
+)
+
+// newTestSource returns a Source reading the table "products"
+// through db, ordered by the column "id".
+func newTestSource(db *fakeDB, batchSize int) *Source {
+	return &Source{
+		config: SourceConfig{
+			TableName:      "products",
+			OrderingColumn: "id",
+			BatchSize:      batchSize,
+		},
+		db:           db.open(),
+		queryBuilder: &ansiQueryBuilder{},
+	}
+}
+
+func TestSource_Read(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	db := &fakeDB{
+		query: func(_ context.Context, query string) ([]string, [][]driver.Value, error) {
+			if strings.Contains(query, "WHERE") {
+				return []string{"id", "name"}, nil, nil
+			}
+			return []string{"id", "name"}, [][]driver.Value{
+				{int64(1), []byte("computer")},
+				{int64(2), "phone"},
+			}, nil
+		},
+	}
+	underTest := newTestSource(db, 2)
+
+	got, err := underTest.Read(ctx)
+	is.NoErr(err)
+	is.Equal(opencdc.OperationCreate, got.Operation)
+	is.Equal(opencdc.StructuredData{"id": int64(1)}, got.Key)
+	is.Equal(opencdc.StructuredData{"id": int64(1), "name": "computer"}, got.Payload.After)
+	is.Equal(`{"lastValue":1}`, string(got.Position))
+	collection, err := got.Metadata.GetCollection()
+	is.NoErr(err)
+	is.Equal("products", collection)
+
+	got, err = underTest.Read(ctx)
+	is.NoErr(err)
+	is.Equal(opencdc.StructuredData{"id": int64(2), "name": "phone"}, got.Payload.After)
+
+	_, err = underTest.Read(ctx)
+	is.Equal(sdk.ErrBackoffRetry, err)
+
+	is.Equal(
+		[]string{
+			"SELECT * FROM `products` ORDER BY `id` ASC LIMIT 2",
+			"SELECT * FROM `products` WHERE (`id` > 2) ORDER BY `id` ASC LIMIT 2",
+		},
+		db.queries,
+	)
+}
+
+func TestSource_Read_FromPosition(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	db := &fakeDB{}
+	underTest := newTestSource(db, 100)
+
+	p, err := parseSourcePosition(opencdc.Position(`{"lastValue":9007199254740993}`))
+	is.NoErr(err)
+	underTest.position = p
+
+	_, err = underTest.Read(ctx)
+	is.Equal(sdk.ErrBackoffRetry, err)
+	is.Equal(
+		[]string{"SELECT * FROM `products` WHERE (`id` > 9007199254740993) ORDER BY `id` ASC LIMIT 100"},
+		db.queries,
+	)
+}
+
+func TestSource_Read_OrderingColumnMissing(t *testing.T) {
+	is := is.New(t)
+
+	db := &fakeDB{
+		query: func(context.Context, string) ([]string, [][]driver.Value, error) {
+			return []string{"name"}, [][]driver.Value{{"computer"}}, nil
+		},
+	}
+	underTest := newTestSource(db, 100)
+
+	_, err := underTest.Read(context.Background())
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), `ordering column "id" not found`))
+}
+
+// softDeleteTable is a fake table with the columns id, deleted and
+// deleted_at, answering the queries of a source with soft deletes.
+type softDeleteTable struct {
+	ids       []int64
+	deletedAt map[int64]int64
+}
+
+func (tbl *softDeleteTable) query(_ context.Context, query string) ([]string, [][]driver.Value, error) {
+	columns := []string{"id", "deleted", "deleted_at"}
+	var rows [][]driver.Value
+	switch {
+	case strings.Contains(query, "IS TRUE"):
+		// rows are flagged in order of their ids
+		after := int64(-1)
+		if m := regexp.MustCompile("`deleted_at` > ([0-9]+)").FindStringSubmatch(query); m != nil {
+			after, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+		for _, id := range tbl.ids {
+			if at, ok := tbl.deletedAt[id]; ok && at > after {
+				rows = append(rows, []driver.Value{id, true, at})
+			}
+		}
+	case strings.Contains(query, "WHERE"):
+	default:
+		for _, id := range tbl.ids {
+			rows = append(rows, []driver.Value{id, false, nil})
+		}
+	}
+	return columns, rows, nil
+}
+
+func TestSource_Read_SoftDelete(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	tbl := &softDeleteTable{ids: []int64{1}, deletedAt: map[int64]int64{}}
+	db := &fakeDB{query: tbl.query}
+	underTest := newTestSource(db, 100)
+	underTest.config.SoftDeleteColumn = "deleted"
+	underTest.config.SoftDeleteWatermarkColumn = "deleted_at"
+
+	got, err := underTest.Read(ctx)
+	is.NoErr(err)
+	is.Equal(opencdc.OperationCreate, got.Operation)
+
+	_, err = underTest.Read(ctx)
+	is.Equal(sdk.ErrBackoffRetry, err)
+
+	// flipping the flag produces a delete on the next poll
+	tbl.deletedAt[1] = 1000
+	got, err = underTest.Read(ctx)
+	is.NoErr(err)
+	is.Equal(opencdc.OperationDelete, got.Operation)
+	is.Equal(opencdc.StructuredData{"id": int64(1)}, got.Key)
+	is.Equal(`{"lastValue":1,"deletedUntil":1000,"deletedLastValue":1}`, string(got.Position))
+
+	// the delete is emitted once
+	_, err = underTest.Read(ctx)
+	is.Equal(sdk.ErrBackoffRetry, err)
+
+	is.Equal(
+		"SELECT * FROM `products` WHERE ((`deleted` IS TRUE) AND (`deleted_at` IS NOT NULL) AND (`id` <= 1) "+
+			"AND ((`deleted_at` > 1000) OR ((`deleted_at` = 1000) AND (`id` > 1)))) ORDER BY `deleted_at` ASC, `id` ASC LIMIT 100",
+		db.queries[len(db.queries)-1],
+	)
+}
+
+func TestSource_Read_SoftDelete_PositionSize(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	tbl := &softDeleteTable{deletedAt: map[int64]int64{}}
+	for id := int64(10); id < 60; id++ {
+		tbl.ids = append(tbl.ids, id)
+	}
+	underTest := newTestSource(&fakeDB{query: tbl.query}, 100)
+	underTest.config.SoftDeleteColumn = "deleted"
+	underTest.config.SoftDeleteWatermarkColumn = "deleted_at"
+
+	for range tbl.ids {
+		_, err := underTest.Read(ctx)
+		is.NoErr(err)
+	}
+
+	// the position holds the watermark of the last delete,
+	// rather than every deleted row
+	var size int
+	for i, id := range tbl.ids {
+		tbl.deletedAt[id] = 1000 + int64(i)
+		got, err := underTest.Read(ctx)
+		is.NoErr(err)
+		is.Equal(opencdc.OperationDelete, got.Operation)
+		is.Equal(opencdc.StructuredData{"id": id, "deleted": true, "deleted_at": 1000 + int64(i)}, got.Payload.Before)
+		if i == 0 {
+			size = len(got.Position)
+		}
+		is.Equal(size, len(got.Position))
+
+		_, err = underTest.Read(ctx)
+		is.Equal(sdk.ErrBackoffRetry, err)
+	}
+}
+
+func TestSource_Read_SoftDeletedBeforeRead(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	// a row flagged before it's read is emitted as a delete only
+	tbl := &softDeleteTable{ids: []int64{1}, deletedAt: map[int64]int64{1: 1000}}
+	db := &fakeDB{query: func(ctx context.Context, query string) ([]string, [][]driver.Value, error) {
+		columns, rows, err := tbl.query(ctx, query)
+		if !strings.Contains(query, "WHERE") {
+			rows = [][]driver.Value{{int64(1), true, int64(1000)}}
+		}
+		return columns, rows, err
+	}}
+	underTest := newTestSource(db, 100)
+	underTest.config.SoftDeleteColumn = "deleted"
+	underTest.config.SoftDeleteWatermarkColumn = "deleted_at"
+
+	got, err := underTest.Read(ctx)
+	is.NoErr(err)
+	is.Equal(opencdc.OperationDelete, got.Operation)
+
+	_, err = underTest.Read(ctx)
+	is.Equal(sdk.ErrBackoffRetry, err)
+}
+
+func TestSource_Read_Snapshot(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	db := &fakeDB{
+		query: func(_ context.Context, query string) ([]string, [][]driver.Value, error) {
+			switch {
+			case strings.HasPrefix(query, "SELECT MAX"):
+				return []string{"max"}, [][]driver.Value{{int64(3)}}, nil
+			case strings.Contains(query, "`id` > 3"):
+				return []string{"id"}, [][]driver.Value{{int64(4)}}, nil
+			case strings.Contains(query, "`id` > 2"):
+				return []string{"id"}, [][]driver.Value{{int64(3)}}, nil
+			default:
+				return []string{"id"}, [][]driver.Value{{int64(1)}, {int64(2)}}, nil
+			}
+		},
+	}
+	underTest := newTestSource(db, 2)
+	is.NoErr(underTest.startSnapshot(ctx))
+
+	var got []opencdc.Record
+	for i := 0; i < 4; i++ {
+		r, err := underTest.Read(ctx)
+		is.NoErr(err)
+		got = append(got, r)
+	}
+
+	for _, r := range got[:3] {
+		is.Equal(opencdc.OperationSnapshot, r.Operation)
+	}
+	is.Equal(opencdc.OperationCreate, got[3].Operation)
+
+	is.Equal(`{"mode":"snapshot","lastValue":1,"snapshotEnd":3}`, string(got[0].Position))
+	is.Equal(`{"mode":"snapshot","lastValue":2,"snapshotEnd":3}`, string(got[1].Position))
+	// the last snapshot record switches the position to incremental reads
+	is.Equal(`{"mode":"incremental","lastValue":3}`, string(got[2].Position))
+	is.Equal(`{"mode":"incremental","lastValue":4}`, string(got[3].Position))
+
+	is.Equal(
+		[]string{
+			"SELECT MAX(`id`) FROM `products`",
+			"SELECT * FROM `products` WHERE (`id` <= 3) ORDER BY `id` ASC LIMIT 2",
+			"SELECT * FROM `products` WHERE ((`id` > 2) AND (`id` <= 3)) ORDER BY `id` ASC LIMIT 2",
+			"SELECT * FROM `products` WHERE (`id` > 3) ORDER BY `id` ASC LIMIT 2",
+		},
+		db.queries,
+	)
+}
+
+func TestSource_Read_SnapshotResume(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	db := &fakeDB{}
+	underTest := newTestSource(db, 2)
+
+	p, err := parseSourcePosition(opencdc.Position(`{"mode":"snapshot","lastValue":2,"snapshotEnd":4}`))
+	is.NoErr(err)
+	underTest.position = p
+
+	// no rows are left in the snapshot, so it's completed
+	// without emitting a record
+	_, err = underTest.Read(ctx)
+	is.Equal(sdk.ErrBackoffRetry, err)
+	is.Equal(sourcePosition{Mode: sourceModeIncremental, LastValue: int64(2)}, underTest.position)
+	is.Equal(
+		[]string{"SELECT * FROM `products` WHERE ((`id` > 2) AND (`id` <= 4)) ORDER BY `id` ASC LIMIT 2"},
+		db.queries,
+	)
+}
+
+func TestSource_StartSnapshot_EmptyTable(t *testing.T) {
+	is := is.New(t)
+
+	db := &fakeDB{
+		query: func(context.Context, string) ([]string, [][]driver.Value, error) {
+			return []string{"max"}, [][]driver.Value{{nil}}, nil
+		},
+	}
+	underTest := newTestSource(db, 2)
+
+	is.NoErr(underTest.startSnapshot(context.Background()))
+	is.Equal(sourcePosition{Mode: sourceModeIncremental}, underTest.position)
+}
+
+func TestSource_Read_SnapshotFetchSize(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	db := &fakeDB{
+		query: func(_ context.Context, query string) ([]string, [][]driver.Value, error) {
+			switch {
+			case strings.HasPrefix(query, "SELECT MAX"):
+				return []string{"max"}, [][]driver.Value{{int64(5)}}, nil
+			case strings.Contains(query, "`id` > 5"):
+				return []string{"id"}, nil, nil
+			case strings.Contains(query, "`id` > 3"):
+				return []string{"id"}, [][]driver.Value{{int64(4)}, {int64(5)}}, nil
+			default:
+				return []string{"id"}, [][]driver.Value{{int64(1)}, {int64(2)}, {int64(3)}}, nil
+			}
+		},
+	}
+	underTest := newTestSource(db, 2)
+	underTest.config.SnapshotFetchSize = 3
+	is.NoErr(underTest.startSnapshot(ctx))
+
+	for i := 1; i <= 5; i++ {
+		r, err := underTest.Read(ctx)
+		is.NoErr(err)
+		is.Equal(opencdc.StructuredData{"id": int64(i)}, r.Key)
+	}
+	_, err := underTest.Read(ctx)
+	is.Equal(sdk.ErrBackoffRetry, err)
+
+	// the snapshot is paged by fetch size, incremental reads by batch size
+	is.Equal(
+		[]string{
+			"SELECT MAX(`id`) FROM `products`",
+			"SELECT * FROM `products` WHERE (`id` <= 5) ORDER BY `id` ASC LIMIT 3",
+			"SELECT * FROM `products` WHERE ((`id` > 3) AND (`id` <= 5)) ORDER BY `id` ASC LIMIT 3",
+			"SELECT * FROM `products` WHERE (`id` > 5) ORDER BY `id` ASC LIMIT 2",
+		},
+		db.queries,
+	)
+}
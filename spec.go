@@ -27,7 +27,7 @@ func Specification() sdk.Specification {
 	return sdk.Specification{
 		Name:        "databricks",
 		Summary:     "A Databricks connector.",
-		Description: "A Databricks connector.",
+		Description: "A Databricks source and destination connector.",
 		Version:     version,
 		Author:      "Meroxa, Inc.",
 	}
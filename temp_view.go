@@ -0,0 +1,110 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// Modes of validating the table on open.
+const (
+	validateTableNone  = "none"
+	validateTableError = "error"
+)
+
+// validateTable checks that the table isn't a temporary view. Depending on
+// the configuration, a temporary view is either logged or returned as an error.
+func (c *sqlClient) validateTable(ctx context.Context) error {
+	temporary, err := c.isTemporaryView(ctx)
+	if err != nil {
+		return fmt.Errorf("failed validating table: %w", err)
+	}
+	if !temporary {
+		return nil
+	}
+
+	if c.config.ValidateTableOnOpen == validateTableError {
+		return fmt.Errorf("%w: %v, use a base table instead", ErrTemporaryView, c.tableName)
+	}
+	sdk.Logger(ctx).Warn().
+		Str("table", c.tableName).
+		Msg("table is a temporary view, writes through a connection pool can land in different sessions; use a base table instead")
+
+	return nil
+}
+
+// isTemporaryView returns true if the table is a temporary view.
+func (c *sqlClient) isTemporaryView(ctx context.Context) (bool, error) {
+	segments := splitIdentifier(c.tableName)
+	if len(segments) > 1 {
+		// qualified names never resolve to session-scoped temporary views
+		return false, nil
+	}
+	name := strings.Trim(segments[0], "`")
+
+	queryCtx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+	query := c.queryBuilder.showViews(name)
+	start := time.Now()
+	rows, err := c.db.QueryContext(queryCtx, query)
+	c.logIfSlow(ctx, query, start)
+	if err != nil {
+		return false, fmt.Errorf("failed to execute show views query: %w", classifyError(timeoutError(ctx, queryCtx, err)))
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return false, fmt.Errorf("failed getting columns: %w", err)
+	}
+	nameIdx, temporaryIdx := -1, -1
+	for i, col := range columns {
+		switch col {
+		case "viewName":
+			nameIdx = i
+		case "isTemporary":
+			temporaryIdx = i
+		}
+	}
+	if nameIdx == -1 || temporaryIdx == -1 {
+		return false, fmt.Errorf("unexpected show views columns %v", columns)
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		var viewName sql.NullString
+		var temporary sql.NullBool
+		for i := range values {
+			values[i] = new(interface{})
+		}
+		values[nameIdx] = &viewName
+		values[temporaryIdx] = &temporary
+		if err := rows.Scan(values...); err != nil {
+			return false, fmt.Errorf("failed to next(): %w", err)
+		}
+
+		if strings.EqualFold(viewName.String, name) && temporary.Bool {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
@@ -0,0 +1,118 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Policies for values which don't match the type of their column.
+const (
+	typeMismatchNone       = "none"
+	typeMismatchError      = "error"
+	typeMismatchDeadLetter = "deadletter"
+	typeMismatchCoerce     = "coerce"
+	typeMismatchSkip       = "skip"
+)
+
+// checkType checks that v matches the type of column col, before the
+// value is sent to Databricks, which rejects mismatched values in ANSI
+// mode. With the coerce policy, a mismatched value is coerced to the
+// column type, otherwise ErrTypeMismatch is returned.
+func (c *sqlClient) checkType(col string, v interface{}) (interface{}, error) {
+	if c.config.TypeMismatch == "" || c.config.TypeMismatch == typeMismatchNone {
+		return v, nil
+	}
+
+	dataType := c.columnType(col)
+	if !isTypeMismatch(dataType, v) {
+		return v, nil
+	}
+	if c.config.TypeMismatch == typeMismatchCoerce {
+		return coerceValue(dataType, v), nil
+	}
+
+	return nil, fmt.Errorf("%w: column %q of type %v can't hold %T value %v", ErrTypeMismatch, col, dataType, v, v)
+}
+
+// isTypeMismatch returns true if v obviously can't be written to a column
+// of type dataType. Only numeric and boolean columns are checked.
+func isTypeMismatch(dataType string, v interface{}) bool {
+	switch {
+	case isIntegerType(dataType):
+		switch v := v.(type) {
+		case string:
+			_, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			return err != nil
+		case float64:
+			return v != math.Trunc(v)
+		case bool:
+			return true
+		}
+	case isFractionalType(dataType):
+		switch v := v.(type) {
+		case string:
+			_, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			return err != nil
+		case bool:
+			return true
+		}
+	case strings.EqualFold(dataType, "BOOLEAN"):
+		switch v := v.(type) {
+		case string:
+			_, err := strconv.ParseBool(strings.TrimSpace(v))
+			return err != nil
+		case float64, int, int64:
+			return true
+		}
+	}
+
+	return false
+}
+
+// coerceValue converts a mismatched value to the column type. Booleans and
+// numbers are converted into each other, fractional numbers written to
+// integer columns are truncated, and other values are set to NULL.
+func coerceValue(dataType string, v interface{}) interface{} {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		if isIntegerType(dataType) {
+			return int64(v)
+		}
+		return v != 0
+	case int:
+		return v != 0
+	case int64:
+		return v != 0
+	default:
+		return nil
+	}
+}
+
+func isFractionalType(dataType string) bool {
+	dataType = strings.ToUpper(dataType)
+	return strings.HasPrefix(dataType, "DECIMAL") ||
+		strings.HasPrefix(dataType, "DEC(") ||
+		strings.HasPrefix(dataType, "NUMERIC") ||
+		dataType == "FLOAT" || dataType == "REAL" || dataType == "DOUBLE"
+}
@@ -0,0 +1,702 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	dbsql "github.com/databricks/databricks-sql-go"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"golang.org/x/exp/slices"
+)
+
+// timestampLayout is the layout used for TIMESTAMP literals.
+// The zone is always included, so that the value doesn't depend
+// on the session time zone.
+const timestampLayout = "2006-01-02 15:04:05.999999Z07:00"
+
+// decimalLiteral is a number which can't be represented as float64 without
+// losing precision, e.g. a DECIMAL(38, 0) value. It's written as an
+// unquoted numeric literal, exactly as it appeared in the record.
+type decimalLiteral string
+
+// unmarshalData decodes the JSON object b into data. Numbers are decoded as
+// float64, unless that loses precision, in which case they're decoded as
+// decimal literals. Numbers nested in objects and arrays are always float64.
+func unmarshalData(b []byte, data *opencdc.StructuredData) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(data); err != nil {
+		return err
+	}
+
+	for k, v := range *data {
+		if n, ok := v.(json.Number); ok {
+			(*data)[k] = numberValue(n)
+			continue
+		}
+		(*data)[k] = floatNumbers(v)
+	}
+
+	return nil
+}
+
+// numberValue returns n as float64, if the shortest representation of the
+// float64 has the same value as n, or as a decimal literal otherwise.
+func numberValue(n json.Number) interface{} {
+	exact, ok := new(big.Rat).SetString(n.String())
+	if !ok {
+		return n.String()
+	}
+	f, err := n.Float64()
+	if err != nil {
+		// out of the float64 range
+		return decimalLiteral(n.String())
+	}
+	short, _ := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	if exact.Cmp(short) != 0 {
+		return decimalLiteral(n.String())
+	}
+
+	return f
+}
+
+// floatNumbers replaces the JSON numbers nested in v with float64 values.
+func floatNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = floatNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = floatNumbers(e)
+		}
+	}
+
+	return v
+}
+
+// metadataMissingSkip leaves metadata columns out when the metadata key
+// is missing, instead of setting them to NULL.
+const metadataMissingSkip = "skip"
+
+// mixedFieldNative converts values based on the column type, instead of
+// writing JSON objects and arrays as JSON strings.
+const mixedFieldNative = "native"
+
+// Formats of booleans written to string columns.
+const (
+	boolFormatUpper   = "upper"
+	boolFormatNumeric = "numeric"
+)
+
+// epochUnits maps the supported units of epoch timestamps to their duration.
+var epochUnits = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+}
+
+// withMetadataColumns adds the configured metadata columns to values.
+func (c *sqlClient) withMetadataColumns(values map[string]interface{}, metadata opencdc.Metadata) {
+	for col, key := range c.config.MetadataColumns {
+		v, ok := metadata[key]
+		switch {
+		case ok:
+			values[col] = v
+		case c.config.MetadataColumnsMissing != metadataMissingSkip:
+			values[col] = nil
+		}
+	}
+}
+
+// convertValues converts record values into the representation
+// used when building SQL statements.
+func (c *sqlClient) convertValues(values map[string]interface{}) (map[string]interface{}, error) {
+	return c.convertValuesWith(values, c.convertValue)
+}
+
+// encryptorFor returns the encryptor configured for col, ignoring case,
+// since the record fields are renamed to the table's spelling of the
+// column names.
+func (c *sqlClient) encryptorFor(col string) (Encryptor, bool) {
+	if e, ok := c.encryptors[col]; ok {
+		return e, true
+	}
+	for name, e := range c.encryptors {
+		if strings.EqualFold(name, col) {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// convertValuesWith encrypts and type checks the values, and converts
+// them with convert.
+func (c *sqlClient) convertValuesWith(
+	values map[string]interface{},
+	convert func(col string, v interface{}) (interface{}, error),
+) (map[string]interface{}, error) {
+	if c.config.MaxColumns > 0 && len(values) > c.config.MaxColumns {
+		return nil, fmt.Errorf("%w: record has %v columns, the maximum is %v", ErrTooManyColumns, len(values), c.config.MaxColumns)
+	}
+
+	converted := make(map[string]interface{}, len(values))
+	for col, v := range values {
+		if e, ok := c.encryptorFor(col); ok {
+			ev, err := e.Encrypt(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed encrypting value for column %q: %w", col, err)
+			}
+			v = ev
+		}
+		v, err := c.checkType(col, v)
+		if err != nil {
+			return nil, err
+		}
+		cv, err := convert(col, v)
+		if err != nil {
+			return nil, fmt.Errorf("failed converting value for column %q: %w", col, err)
+		}
+		converted[col] = cv
+	}
+
+	return converted, nil
+}
+
+func (c *sqlClient) convertValue(col string, v interface{}) (interface{}, error) {
+	if d, ok := v.(decimalLiteral); ok {
+		return goqu.L(string(d)), nil
+	}
+	if isBinaryType(c.columnType(col)) {
+		b, ok, err := c.binaryValue(col, v)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return binaryLiteral(b), nil
+		}
+	}
+	if c.isEpochColumn(col) {
+		if n, ok := toInt64(v); ok {
+			unit, ok := epochUnits[c.config.EpochTimestampUnit]
+			if !ok {
+				return nil, fmt.Errorf("unknown epoch unit %q", c.config.EpochTimestampUnit)
+			}
+			return timestampLiteral(time.Unix(0, n*int64(unit))), nil
+		}
+	}
+
+	if t, ok := v.(time.Time); ok {
+		return timestampLiteral(t), nil
+	}
+	if str, ok := v.(string); ok && isTimestampType(c.columnType(col)) {
+		// RFC 3339 is how times are encoded in JSON payloads
+		if t, err := time.Parse(time.RFC3339Nano, str); err == nil {
+			return timestampLiteral(t), nil
+		}
+		if len(c.config.TimestampInputFormats) > 0 {
+			t, err := parseTimestamp(str, c.config.TimestampInputFormats)
+			if err != nil {
+				return nil, err
+			}
+			return timestampLiteral(t), nil
+		}
+	}
+
+	if c.config.NativeComplexTypes {
+		if elemType, ok := arrayElementType(c.columnType(col)); ok {
+			if arr, ok := v.([]interface{}); ok {
+				return arrayLiteral(arr, elemType)
+			}
+		}
+		if keyType, valueType, ok := mapTypes(c.columnType(col)); ok {
+			if m, ok := v.(map[string]interface{}); ok {
+				return mapLiteral(m, keyType, valueType)
+			}
+		}
+		if fields, ok := structFields(c.columnType(col)); ok {
+			if m, ok := v.(map[string]interface{}); ok {
+				return structLiteral(m, fields)
+			}
+		}
+	}
+
+	if c.config.MixedFieldHandling == mixedFieldNative {
+		return c.nativeValue(col, v)
+	}
+	if isComplexValue(v) {
+		return jsonString(v)
+	}
+
+	if b, ok := v.(bool); ok && isStringType(c.columnType(col)) {
+		return formatBool(b, c.config.BooleanStringFormat), nil
+	}
+
+	return v, nil
+}
+
+// plainValue converts v into a plain value, rather than a SQL literal, for
+// values which don't end up in the SQL string. Timestamps are formatted in
+// RFC 3339, which Databricks casts to TIMESTAMP, decimals are kept as
+// json.Number and binary values are encoded in base64. JSON objects and
+// arrays are kept as they are, unless they're written to string columns.
+func (c *sqlClient) plainValue(col string, v interface{}) (interface{}, error) {
+	if d, ok := v.(decimalLiteral); ok {
+		return json.Number(d), nil
+	}
+	if isBinaryType(c.columnType(col)) {
+		b, ok, err := c.binaryValue(col, v)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return base64.StdEncoding.EncodeToString(b), nil
+		}
+	}
+	if c.isEpochColumn(col) {
+		if n, ok := toInt64(v); ok {
+			unit, ok := epochUnits[c.config.EpochTimestampUnit]
+			if !ok {
+				return nil, fmt.Errorf("unknown epoch unit %q", c.config.EpochTimestampUnit)
+			}
+			v = time.Unix(0, n*int64(unit))
+		}
+	}
+
+	if t, ok := v.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano), nil
+	}
+	if str, ok := v.(string); ok && isTimestampType(c.columnType(col)) && len(c.config.TimestampInputFormats) > 0 {
+		if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+			t, err := parseTimestamp(str, c.config.TimestampInputFormats)
+			if err != nil {
+				return nil, err
+			}
+			return t.UTC().Format(time.RFC3339Nano), nil
+		}
+	}
+
+	if isComplexValue(v) && isStringType(c.columnType(col)) {
+		return jsonString(v)
+	}
+	if b, ok := v.(bool); ok && isStringType(c.columnType(col)) {
+		return formatBool(b, c.config.BooleanStringFormat), nil
+	}
+
+	return v, nil
+}
+
+// parameterValue converts v into a statement parameter. Numbers are typed
+// explicitly, since the driver sends integers as INT and floats as FLOAT,
+// which don't hold every BIGINT and DOUBLE value. Whole numbers are BIGINT,
+// like the literals they're otherwise written as. JSON objects and arrays
+// are passed as JSON strings, binary values as binaryParameter.
+func (c *sqlClient) parameterValue(col string, v interface{}) (interface{}, error) {
+	v, err := c.plainValue(col, v)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := v.(string); ok && isBinaryType(c.columnType(col)) {
+		return binaryParameter(s), nil
+	}
+	if n, ok := toInt64(v); ok {
+		return dbsql.Parameter{Type: dbsql.SqlBigInt, Value: strconv.FormatInt(n, 10)}, nil
+	}
+
+	switch v := v.(type) {
+	case json.Number:
+		return dbsql.Parameter{Type: dbsql.SqlDecimal, Value: v.String()}, nil
+	case float64:
+		return dbsql.Parameter{Type: dbsql.SqlDouble, Value: strconv.FormatFloat(v, 'g', -1, 64)}, nil
+	case map[string]interface{}, []interface{}:
+		return jsonString(v)
+	}
+
+	return v, nil
+}
+
+// nativeValue converts v based on the type of the column, regardless of
+// whether v is a JSON object or array, or a string. Objects and arrays
+// written to string columns are written as JSON, strings written to ARRAY
+// and MAP columns are parsed as JSON.
+func (c *sqlClient) nativeValue(col string, v interface{}) (interface{}, error) {
+	dataType := c.columnType(col)
+	_, _, isMap := mapTypes(dataType)
+	_, isArray := arrayElementType(dataType)
+	_, isStruct := structFields(dataType)
+
+	switch {
+	case isStringType(dataType) && isComplexValue(v):
+		return jsonString(v)
+	case isMap || isArray || isStruct:
+		if s, ok := v.(string); ok {
+			var parsed interface{}
+			if err := json.Unmarshal([]byte(s), &parsed); err != nil {
+				return nil, fmt.Errorf("failed parsing %v value as JSON: %w", dataType, err)
+			}
+			v = parsed
+		}
+		return elementValue(v, dataType)
+	}
+
+	if b, ok := v.(bool); ok && isStringType(dataType) {
+		return formatBool(b, c.config.BooleanStringFormat), nil
+	}
+
+	return v, nil
+}
+
+// isComplexValue returns true if v is a JSON object or array.
+func isComplexValue(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func jsonString(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed marshalling value: %w", err)
+	}
+
+	return string(b), nil
+}
+
+// arrayLiteral renders arr as an array of elemType.
+func arrayLiteral(arr []interface{}, elemType string) (exp.LiteralExpression, error) {
+	if len(arr) == 0 {
+		// array() on its own is an array of VOID
+		return goqu.L("CAST(array() AS ARRAY<" + strings.ToUpper(elemType) + ">)"), nil
+	}
+
+	placeholders := make([]string, len(arr))
+	elems := make([]interface{}, len(arr))
+	for i, e := range arr {
+		ce, err := elementValue(e, elemType)
+		if err != nil {
+			return nil, fmt.Errorf("failed converting array element %v: %w", i, err)
+		}
+		placeholders[i] = "?"
+		elems[i] = ce
+	}
+
+	return goqu.L("array("+strings.Join(placeholders, ", ")+")", elems...), nil
+}
+
+// mapLiteral renders m as a map of keyType to valueType.
+// Entries are ordered by key, so that the generated SQL is stable.
+func mapLiteral(m map[string]interface{}, keyType, valueType string) (exp.LiteralExpression, error) {
+	if len(m) == 0 {
+		// map() on its own is a map of VOID to VOID
+		return goqu.L("CAST(map() AS MAP<" + strings.ToUpper(keyType) + ", " + strings.ToUpper(valueType) + ">)"), nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	placeholders := make([]string, len(keys))
+	args := make([]interface{}, 0, 2*len(keys))
+	for i, k := range keys {
+		ck, err := mapKey(k, keyType)
+		if err != nil {
+			return nil, err
+		}
+		cv, err := elementValue(m[k], valueType)
+		if err != nil {
+			return nil, fmt.Errorf("failed converting map value for key %q: %w", k, err)
+		}
+		placeholders[i] = "?, ?"
+		args = append(args, ck, cv)
+	}
+
+	return goqu.L("map("+strings.Join(placeholders, ", ")+")", args...), nil
+}
+
+// structField is a field of a STRUCT type.
+type structField struct {
+	name     string
+	dataType string
+}
+
+// structLiteral renders m as a struct with the given fields, in field order.
+// Fields missing from m are NULL, keys of m which aren't fields fail.
+func structLiteral(m map[string]interface{}, fields []structField) (exp.LiteralExpression, error) {
+	known := make(map[string]bool, len(fields))
+	placeholders := make([]string, len(fields))
+	args := make([]interface{}, 0, 2*len(fields))
+	for i, f := range fields {
+		known[f.name] = true
+		cv, err := elementValue(m[f.name], f.dataType)
+		if err != nil {
+			return nil, fmt.Errorf("failed converting struct field %q: %w", f.name, err)
+		}
+		placeholders[i] = "?, ?"
+		args = append(args, f.name, cv)
+	}
+	for k := range m {
+		if !known[k] {
+			return nil, fmt.Errorf("struct has no field %q", k)
+		}
+	}
+
+	return goqu.L("named_struct("+strings.Join(placeholders, ", ")+")", args...), nil
+}
+
+// mapKey converts a JSON object key into a key of type keyType.
+func mapKey(k string, keyType string) (interface{}, error) {
+	if !isIntegerType(keyType) {
+		return k, nil
+	}
+	n, err := strconv.ParseInt(k, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("expected a whole number map key for %v, got %q", keyType, k)
+	}
+
+	return n, nil
+}
+
+// elementValue converts v into a value of the element type dataType.
+func elementValue(v interface{}, dataType string) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if elemType, ok := arrayElementType(dataType); ok {
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array for %v, got %T", dataType, v)
+		}
+		return arrayLiteral(arr, elemType)
+	}
+	if keyType, valueType, ok := mapTypes(dataType); ok {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object for %v, got %T", dataType, v)
+		}
+		return mapLiteral(m, keyType, valueType)
+	}
+	if fields, ok := structFields(dataType); ok {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object for %v, got %T", dataType, v)
+		}
+		return structLiteral(m, fields)
+	}
+
+	switch {
+	case isIntegerType(dataType):
+		if n, ok := toInt64(v); ok {
+			return n, nil
+		}
+		return nil, fmt.Errorf("expected a whole number for %v, got %v", dataType, v)
+	case isStringType(dataType):
+		if _, ok := v.(string); ok {
+			return v, nil
+		}
+		return jsonString(v)
+	default:
+		return v, nil
+	}
+}
+
+// arrayElementType returns the element type of an ARRAY type,
+// e.g. "int" for "array<int>".
+func arrayElementType(dataType string) (string, bool) {
+	lower := strings.ToLower(dataType)
+	if !strings.HasPrefix(lower, "array<") || !strings.HasSuffix(lower, ">") {
+		return "", false
+	}
+
+	return dataType[len("array<") : len(dataType)-1], true
+}
+
+// mapTypes returns the key and value types of a MAP type,
+// e.g. "string" and "int" for "map<string,int>".
+func mapTypes(dataType string) (string, string, bool) {
+	lower := strings.ToLower(dataType)
+	if !strings.HasPrefix(lower, "map<") || !strings.HasSuffix(lower, ">") {
+		return "", "", false
+	}
+	inner := dataType[len("map<") : len(dataType)-1]
+
+	// split on the first comma which isn't nested in another type
+	depth := 0
+	for i, r := range inner {
+		switch r {
+		case '<':
+			depth++
+		case '>':
+			depth--
+		case ',':
+			if depth == 0 {
+				return strings.TrimSpace(inner[:i]), strings.TrimSpace(inner[i+1:]), true
+			}
+		}
+	}
+
+	return "", "", false
+}
+
+// structFields returns the fields of a STRUCT type, e.g. "name" of type
+// "string" and "tags" of type "array<string>" for
+// "struct<name:string,tags:array<string>>".
+func structFields(dataType string) ([]structField, bool) {
+	lower := strings.ToLower(dataType)
+	if !strings.HasPrefix(lower, "struct<") || !strings.HasSuffix(lower, ">") {
+		return nil, false
+	}
+	inner := dataType[len("struct<") : len(dataType)-1]
+
+	var fields []structField
+	for _, def := range splitTopLevel(inner) {
+		name, dataType, ok := strings.Cut(def, ":")
+		if !ok {
+			return nil, false
+		}
+		fields = append(fields, structField{
+			name:     strings.Trim(strings.TrimSpace(name), "`"),
+			dataType: strings.TrimSpace(dataType),
+		})
+	}
+
+	return fields, len(fields) > 0
+}
+
+// splitTopLevel splits s on the commas which aren't
+// nested in another type, e.g. in decimal(10,2).
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '<', '(':
+			depth++
+		case '>', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if strings.TrimSpace(s[start:]) != "" {
+		parts = append(parts, s[start:])
+	}
+
+	return parts
+}
+
+func isIntegerType(dataType string) bool {
+	switch strings.ToUpper(dataType) {
+	case "TINYINT", "SMALLINT", "INT", "INTEGER", "BIGINT", "LONG", "SHORT", "BYTE":
+		return true
+	default:
+		return false
+	}
+}
+
+// formatBool renders a boolean destined for a string column.
+func formatBool(b bool, format string) string {
+	switch format {
+	case boolFormatUpper:
+		return strings.ToUpper(strconv.FormatBool(b))
+	case boolFormatNumeric:
+		if b {
+			return "1"
+		}
+		return "0"
+	default:
+		return strconv.FormatBool(b)
+	}
+}
+
+// isEpochColumn returns true if numeric values for the column
+// need to be converted from epoch numbers into timestamps.
+func (c *sqlClient) isEpochColumn(col string) bool {
+	if slices.Contains(c.config.EpochTimestampColumns, col) {
+		return true
+	}
+
+	return c.config.EpochTimestampAutoDetect && isTimestampType(c.columnType(col))
+}
+
+func isStringType(dataType string) bool {
+	dataType = strings.ToUpper(dataType)
+	return strings.HasPrefix(dataType, "STRING") ||
+		strings.HasPrefix(dataType, "VARCHAR") ||
+		strings.HasPrefix(dataType, "CHAR")
+}
+
+func isTimestampType(dataType string) bool {
+	return strings.HasPrefix(strings.ToUpper(dataType), "TIMESTAMP")
+}
+
+// timestampLiteral renders t as a Databricks TIMESTAMP literal in UTC.
+func timestampLiteral(t time.Time) exp.LiteralExpression {
+	return goqu.L("TIMESTAMP ?", t.UTC().Format(timestampLayout))
+}
+
+// parseTimestamp parses s using the first of the layouts that matches.
+func parseTimestamp(s string, layouts []string) (time.Time, error) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("timestamp %q doesn't match any of the formats %q", s, layouts)
+}
+
+// toInt64 returns v as an int64, if v is a whole number.
+func toInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		if v != float64(int64(v)) {
+			return 0, false
+		}
+		return int64(v), true
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,663 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conduitio/conduit-commons/opencdc"
+	"github.com/matryer/is"
+)
+
+func TestConvertValues_EpochTimestamps(t *testing.T) {
+	testCases := []struct {
+		name  string
+		unit  string
+		value interface{}
+	}{
+		{name: "seconds", unit: "s", value: float64(1700000000)},
+		{name: "milliseconds", unit: "ms", value: float64(1700000000123)},
+		{name: "microseconds", unit: "us", value: int64(1700000000123456)},
+	}
+	want := map[string]string{
+		"s":  "INSERT INTO `events` (`created_at`) VALUES (TIMESTAMP '2023-11-14 22:13:20Z')",
+		"ms": "INSERT INTO `events` (`created_at`) VALUES (TIMESTAMP '2023-11-14 22:13:20.123Z')",
+		"us": "INSERT INTO `events` (`created_at`) VALUES (TIMESTAMP '2023-11-14 22:13:20.123456Z')",
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &sqlClient{
+				config: Config{
+					EpochTimestampColumns: []string{"created_at"},
+					EpochTimestampUnit:    tc.unit,
+				},
+			}
+			values, err := underTest.convertValues(map[string]interface{}{"created_at": tc.value})
+			is.NoErr(err)
+
+			sql, err := (&ansiQueryBuilder{}).buildInsert("events", values)
+			is.NoErr(err)
+			is.Equal(want[tc.unit], sql)
+		})
+	}
+}
+
+func TestConvertValues_EpochAutoDetect(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &sqlClient{
+		config: Config{
+			EpochTimestampUnit:       "s",
+			EpochTimestampAutoDetect: true,
+		},
+		columnTypes: map[string]string{"created_at": "timestamp", "count": "bigint"},
+	}
+	values, err := underTest.convertValues(map[string]interface{}{
+		"created_at": float64(1700000000),
+		"count":      float64(1700000000),
+	})
+	is.NoErr(err)
+	is.Equal(float64(1700000000), values["count"]) // non-timestamp column should be left as is
+
+	sql, err := (&ansiQueryBuilder{}).buildUpdate(
+		"events",
+		newRecordKey(map[string]interface{}{"id": 1}, nil),
+		values,
+	)
+	is.NoErr(err)
+	is.Equal("UPDATE `events` SET `count`=1700000000,`created_at`=TIMESTAMP '2023-11-14 22:13:20Z' WHERE (`id` = 1)", sql)
+}
+
+func TestWithMetadataColumns(t *testing.T) {
+	testCases := []struct {
+		name    string
+		missing string
+		want    map[string]interface{}
+	}{
+		{
+			name:    "missing set to null",
+			missing: "null",
+			want:    map[string]interface{}{"id": 1, "ingest_source": "orders-db", "region": nil},
+		},
+		{
+			name:    "missing skipped",
+			missing: "skip",
+			want:    map[string]interface{}{"id": 1, "ingest_source": "orders-db"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &sqlClient{
+				config: Config{
+					MetadataColumns:        map[string]string{"ingest_source": "source", "region": "region"},
+					MetadataColumnsMissing: tc.missing,
+				},
+			}
+			values := map[string]interface{}{"id": 1}
+			underTest.withMetadataColumns(values, opencdc.Metadata{"source": "orders-db"})
+			is.Equal(tc.want, values)
+		})
+	}
+}
+
+func TestConvertValues_MaxColumns(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &sqlClient{config: Config{MaxColumns: 2}}
+
+	_, err := underTest.convertValues(map[string]interface{}{"a": 1, "b": 2})
+	is.NoErr(err)
+
+	_, err = underTest.convertValues(map[string]interface{}{"a": 1, "b": 2, "c": 3})
+	is.True(errors.Is(err, ErrTooManyColumns))
+}
+
+func TestConvertValues_BooleanStringFormat(t *testing.T) {
+	testCases := []struct {
+		format string
+		want   []string
+	}{
+		{format: "lower", want: []string{"true", "false"}},
+		{format: "upper", want: []string{"TRUE", "FALSE"}},
+		{format: "numeric", want: []string{"1", "0"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &sqlClient{
+				config:      Config{BooleanStringFormat: tc.format},
+				columnTypes: map[string]string{"active": "string", "flag": "varchar(5)", "enabled": "boolean"},
+			}
+			values, err := underTest.convertValues(map[string]interface{}{
+				"active":  true,
+				"flag":    false,
+				"enabled": true,
+			})
+			is.NoErr(err)
+			is.Equal(tc.want[0], values["active"])
+			is.Equal(tc.want[1], values["flag"])
+			is.Equal(true, values["enabled"]) // boolean columns should be left as is
+		})
+	}
+}
+
+func TestConvertValues_TimestampInputFormats(t *testing.T) {
+	testCases := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{
+			name:  "RFC3339",
+			value: "2023-11-14T23:13:20+01:00",
+			want:  "INSERT INTO `events` (`created_at`) VALUES (TIMESTAMP '2023-11-14 22:13:20Z')",
+		},
+		{
+			name:  "RFC3339Nano",
+			value: "2023-11-14T22:13:20.123456789Z",
+			want:  "INSERT INTO `events` (`created_at`) VALUES (TIMESTAMP '2023-11-14 22:13:20.123456Z')",
+		},
+		{
+			name:  "custom",
+			value: "14/11/2023 22:13",
+			want:  "INSERT INTO `events` (`created_at`) VALUES (TIMESTAMP '2023-11-14 22:13:00Z')",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &sqlClient{
+				config: Config{
+					TimestampInputFormats: []string{time.RFC3339, time.RFC3339Nano, "02/01/2006 15:04"},
+				},
+				columnTypes: map[string]string{"created_at": "timestamp"},
+			}
+			values, err := underTest.convertValues(map[string]interface{}{"created_at": tc.value})
+			is.NoErr(err)
+
+			sql, err := (&ansiQueryBuilder{}).buildInsert("events", values)
+			is.NoErr(err)
+			is.Equal(tc.want, sql)
+		})
+	}
+}
+
+func TestConvertValues_Timestamps(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+
+	testCases := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{
+			name:  "RFC3339 string with offset",
+			value: "2024-06-01T10:15:30.123456+02:00",
+			want:  "INSERT INTO `events` (`created_at`) VALUES (TIMESTAMP '2024-06-01 08:15:30.123456Z')",
+		},
+		{
+			name:  "time with offset",
+			value: time.Date(2024, 6, 1, 10, 15, 30, 123456000, berlin),
+			want:  "INSERT INTO `events` (`created_at`) VALUES (TIMESTAMP '2024-06-01 08:15:30.123456Z')",
+		},
+		{
+			name:  "not a timestamp",
+			value: "yesterday",
+			want:  "INSERT INTO `events` (`created_at`) VALUES ('yesterday')",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &sqlClient{columnTypes: map[string]string{"created_at": "timestamp"}}
+			values, err := underTest.convertValues(map[string]interface{}{"created_at": tc.value})
+			is.NoErr(err)
+
+			sql, err := (&ansiQueryBuilder{}).buildInsert("events", values)
+			is.NoErr(err)
+			is.Equal(tc.want, sql)
+		})
+	}
+}
+
+func TestConvertValues_Binary(t *testing.T) {
+	testCases := []struct {
+		name     string
+		encoding string
+		value    interface{}
+		want     string
+		wantErr  string
+	}{
+		{
+			name:  "base64 string",
+			value: "AQL/",
+			want:  "INSERT INTO `files` (`content`) VALUES (X'0102ff')",
+		},
+		{
+			name:     "hex string",
+			encoding: "hex",
+			value:    "0102FF",
+			want:     "INSERT INTO `files` (`content`) VALUES (X'0102ff')",
+		},
+		{
+			name:  "bytes",
+			value: []byte{0x01, 0x02, 0xff},
+			want:  "INSERT INTO `files` (`content`) VALUES (X'0102ff')",
+		},
+		{
+			name:  "empty",
+			value: "",
+			want:  "INSERT INTO `files` (`content`) VALUES (X'')",
+		},
+		{
+			name:  "null",
+			value: nil,
+			want:  "INSERT INTO `files` (`content`) VALUES (NULL)",
+		},
+		{
+			name:    "invalid base64",
+			value:   "not base64!",
+			wantErr: `failed decoding base64 value for BINARY column "content"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &sqlClient{
+				config:      Config{BinaryInputEncoding: tc.encoding},
+				columnTypes: map[string]string{"content": "binary"},
+			}
+			values, err := underTest.convertValues(map[string]interface{}{"content": tc.value})
+			if tc.wantErr != "" {
+				is.True(err != nil)
+				is.True(strings.Contains(err.Error(), tc.wantErr))
+				return
+			}
+			is.NoErr(err)
+
+			sql, err := (&ansiQueryBuilder{}).buildInsert("files", values)
+			is.NoErr(err)
+			is.Equal(tc.want, sql)
+		})
+	}
+}
+
+func TestParameterValue_Binary(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &sqlClient{
+		config:      Config{BinaryInputEncoding: "hex"},
+		columnTypes: map[string]string{"content": "binary", "name": "string"},
+	}
+	values, err := underTest.convertValuesWith(
+		map[string]interface{}{"content": "0102ff", "name": "AQL/"},
+		underTest.parameterValue,
+	)
+	is.NoErr(err)
+	is.Equal(binaryParameter("AQL/"), values["content"])
+	is.Equal("AQL/", values["name"]) // strings of other columns aren't decoded
+}
+
+func TestConvertValues_TimestampInputFormats_Unparseable(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &sqlClient{
+		config: Config{
+			TimestampInputFormats: []string{time.RFC3339, "02/01/2006"},
+		},
+		columnTypes: map[string]string{"created_at": "timestamp", "name": "string"},
+	}
+	values, err := underTest.convertValues(map[string]interface{}{"name": "not a timestamp"})
+	is.NoErr(err)
+	is.Equal("not a timestamp", values["name"]) // non-timestamp column should be left as is
+
+	_, err = underTest.convertValues(map[string]interface{}{"created_at": "yesterday"})
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), time.RFC3339))
+	is.True(strings.Contains(err.Error(), "02/01/2006"))
+}
+
+type reverseEncryptor struct{}
+
+func (reverseEncryptor) Encrypt(value interface{}) (interface{}, error) {
+	s := []rune(value.(string))
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+	return string(s), nil
+}
+
+func TestConvertValues_Encryptors(t *testing.T) {
+	is := is.New(t)
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	aesEncryptor, err := NewAESEncryptor(key)
+	is.NoErr(err)
+
+	underTest := &sqlClient{
+		encryptors: map[string]Encryptor{
+			"email": reverseEncryptor{},
+			"ssn":   aesEncryptor,
+			"name":  NoopEncryptor{},
+		},
+	}
+	values, err := underTest.convertValues(map[string]interface{}{
+		"id":    1,
+		"name":  "Jane",
+		"email": "jane@example.com",
+		"ssn":   "123-45-6789",
+	})
+	is.NoErr(err)
+	is.Equal(1, values["id"])
+	is.Equal("Jane", values["name"])
+	is.Equal("moc.elpmaxe@enaj", values["email"])
+
+	// the AES encrypted value decrypts to the original one
+	sealed, err := base64.StdEncoding.DecodeString(values["ssn"].(string))
+	is.NoErr(err)
+	block, err := aes.NewCipher(key)
+	is.NoErr(err)
+	aead, err := cipher.NewGCM(block)
+	is.NoErr(err)
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	is.NoErr(err)
+	is.Equal("123-45-6789", string(plaintext))
+}
+
+func TestConvertValues_Arrays(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dataType string
+		value    []interface{}
+		want     string
+	}{
+		{
+			name:     "strings",
+			dataType: "array<string>",
+			value:    []interface{}{"a", "it's"},
+			want:     "INSERT INTO `events` (`tags`) VALUES (array('a', 'it\\'s'))",
+		},
+		{
+			name:     "ints",
+			dataType: "array<int>",
+			value:    []interface{}{float64(1), float64(2), nil},
+			want:     "INSERT INTO `events` (`tags`) VALUES (array(1, 2, NULL))",
+		},
+		{
+			name:     "nested",
+			dataType: "array<array<bigint>>",
+			value:    []interface{}{[]interface{}{float64(1), float64(2)}, []interface{}{}},
+			want:     "INSERT INTO `events` (`tags`) VALUES (array(array(1, 2), CAST(array() AS ARRAY<BIGINT>)))",
+		},
+		{
+			name:     "empty",
+			dataType: "array<string>",
+			value:    []interface{}{},
+			want:     "INSERT INTO `events` (`tags`) VALUES (CAST(array() AS ARRAY<STRING>))",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &sqlClient{
+				config:      Config{NativeComplexTypes: true},
+				columnTypes: map[string]string{"tags": tc.dataType},
+			}
+			values, err := underTest.convertValues(map[string]interface{}{"tags": tc.value})
+			is.NoErr(err)
+
+			sql, err := (&ansiQueryBuilder{}).buildInsert("events", values)
+			is.NoErr(err)
+			is.Equal(tc.want, sql)
+		})
+	}
+}
+
+func TestConvertValues_Maps(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dataType string
+		value    map[string]interface{}
+		want     string
+	}{
+		{
+			name:     "string to int",
+			dataType: "map<string,int>",
+			value:    map[string]interface{}{"b": float64(2), "a": float64(1)},
+			want:     "INSERT INTO `events` (`counts`) VALUES (map('a', 1, 'b', 2))",
+		},
+		{
+			name:     "int to array",
+			dataType: "map<int,array<string>>",
+			value:    map[string]interface{}{"1": []interface{}{"x"}},
+			want:     "INSERT INTO `events` (`counts`) VALUES (map(1, array('x')))",
+		},
+		{
+			name:     "empty",
+			dataType: "map<string,int>",
+			value:    map[string]interface{}{},
+			want:     "INSERT INTO `events` (`counts`) VALUES (CAST(map() AS MAP<STRING, INT>))",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &sqlClient{
+				config:      Config{NativeComplexTypes: true},
+				columnTypes: map[string]string{"counts": tc.dataType},
+			}
+			values, err := underTest.convertValues(map[string]interface{}{"counts": tc.value})
+			is.NoErr(err)
+
+			sql, err := (&ansiQueryBuilder{}).buildInsert("events", values)
+			is.NoErr(err)
+			is.Equal(tc.want, sql)
+		})
+	}
+}
+
+func TestConvertValues_Structs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		dataType string
+		value    map[string]interface{}
+		want     string
+	}{
+		{
+			name:     "flat",
+			dataType: "struct<name:string,qty:int,price:decimal(10,2)>",
+			value:    map[string]interface{}{"qty": float64(2), "name": "cup", "price": 9.5},
+			want:     "INSERT INTO `events` (`item`) VALUES (named_struct('name', 'cup', 'qty', 2, 'price', 9.5))",
+		},
+		{
+			name:     "nested and missing fields",
+			dataType: "struct<tags:array<string>,dims:struct<w:int,h:int>>",
+			value:    map[string]interface{}{"dims": map[string]interface{}{"w": float64(3)}},
+			want:     "INSERT INTO `events` (`item`) VALUES (named_struct('tags', NULL, 'dims', named_struct('w', 3, 'h', NULL)))",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &sqlClient{
+				config:      Config{NativeComplexTypes: true},
+				columnTypes: map[string]string{"item": tc.dataType},
+			}
+			values, err := underTest.convertValues(map[string]interface{}{"item": tc.value})
+			is.NoErr(err)
+
+			sql, err := (&ansiQueryBuilder{}).buildInsert("events", values)
+			is.NoErr(err)
+			is.Equal(tc.want, sql)
+		})
+	}
+}
+
+func TestConvertValues_Structs_UnknownField(t *testing.T) {
+	is := is.New(t)
+
+	underTest := &sqlClient{
+		config:      Config{NativeComplexTypes: true},
+		columnTypes: map[string]string{"item": "struct<name:string>"},
+	}
+	_, err := underTest.convertValues(map[string]interface{}{"item": map[string]interface{}{"color": "red"}})
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), `struct has no field "color"`))
+}
+
+func TestConvertValues_MixedFieldHandling(t *testing.T) {
+	// the same fields as objects in one record and strings in the next
+	records := []map[string]interface{}{
+		{"attrs": map[string]interface{}{"color": "red"}, "tags": []interface{}{"a"}},
+		{"attrs": `{"color":"blue"}`, "tags": `["b"]`},
+	}
+
+	testCases := []struct {
+		mode string
+		want []string
+	}{
+		{
+			mode: "json",
+			want: []string{
+				"INSERT INTO `events` (`attrs`, `tags`) VALUES ('{\"color\":\"red\"}', '[\"a\"]')",
+				"INSERT INTO `events` (`attrs`, `tags`) VALUES ('{\"color\":\"blue\"}', '[\"b\"]')",
+			},
+		},
+		{
+			mode: "native",
+			want: []string{
+				"INSERT INTO `events` (`attrs`, `tags`) VALUES ('{\"color\":\"red\"}', array('a'))",
+				"INSERT INTO `events` (`attrs`, `tags`) VALUES ('{\"color\":\"blue\"}', array('b'))",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.mode, func(t *testing.T) {
+			is := is.New(t)
+
+			underTest := &sqlClient{
+				config:      Config{MixedFieldHandling: tc.mode},
+				columnTypes: map[string]string{"attrs": "string", "tags": "array<string>"},
+			}
+			for i, record := range records {
+				values, err := underTest.convertValues(record)
+				is.NoErr(err)
+
+				sql, err := (&ansiQueryBuilder{}).buildInsertBatch(
+					"events",
+					[]string{"attrs", "tags"},
+					[][]interface{}{{values["attrs"], values["tags"]}},
+				)
+				is.NoErr(err)
+				is.Equal(tc.want[i], sql)
+			}
+		})
+	}
+}
+
+func TestIsTypeMismatch(t *testing.T) {
+	testCases := []struct {
+		dataType string
+		value    interface{}
+		want     bool
+	}{
+		{dataType: "int", value: "12", want: false},
+		{dataType: "int", value: "twelve", want: true},
+		{dataType: "bigint", value: 1.5, want: true},
+		{dataType: "bigint", value: float64(2), want: false},
+		{dataType: "decimal(10,2)", value: "1.25", want: false},
+		{dataType: "double", value: true, want: true},
+		{dataType: "boolean", value: "yes", want: true},
+		{dataType: "boolean", value: float64(1), want: true},
+		{dataType: "string", value: float64(1), want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%v %v", tc.dataType, tc.value), func(t *testing.T) {
+			is := is.New(t)
+			is.Equal(tc.want, isTypeMismatch(tc.dataType, tc.value))
+		})
+	}
+}
+
+func TestUnmarshalData_Decimals(t *testing.T) {
+	is := is.New(t)
+
+	var data opencdc.StructuredData
+	err := unmarshalData([]byte(`{
+		"price": 19.99,
+		"count": 3,
+		"amount": 12345678901234567890123456789012345678,
+		"ratio": 0.12345678901234567890123456789,
+		"huge": 1e400,
+		"nested": {"amount": 12345678901234567890}
+	}`), &data)
+	is.NoErr(err)
+
+	is.Equal(19.99, data["price"])
+	is.Equal(float64(3), data["count"])
+	is.Equal(decimalLiteral("12345678901234567890123456789012345678"), data["amount"])
+	is.Equal(decimalLiteral("0.12345678901234567890123456789"), data["ratio"])
+	is.Equal(decimalLiteral("1e400"), data["huge"])
+	is.Equal(map[string]interface{}{"amount": float64(12345678901234567890)}, data["nested"])
+}
+
+func TestSqlClient_Update_Decimal(t *testing.T) {
+	is := is.New(t)
+
+	db := &fakeDB{}
+	underTest := newTestClient(db, Config{})
+
+	err := underTest.Update(context.Background(), opencdc.Record{
+		Operation: opencdc.OperationUpdate,
+		Key:       opencdc.RawData(`{"id":1}`),
+		Payload:   opencdc.Change{After: opencdc.RawData(`{"amount":12345678901234567890123456789012345678}`)},
+	})
+	is.NoErr(err)
+	// all 38 digits are written, as an unquoted literal
+	is.Equal(
+		[]string{"UPDATE `products` SET `amount`=12345678901234567890123456789012345678 WHERE (`id` = 1)"},
+		db.executed(),
+	)
+}
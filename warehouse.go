@@ -0,0 +1,52 @@
+// Copyright © 2023 Meroxa, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package databricks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sdk "github.com/conduitio/conduit-connector-sdk"
+)
+
+// coldStartThreshold is the ping duration after which the warehouse
+// is assumed to have been started by the ping.
+const coldStartThreshold = 10 * time.Second
+
+// ping checks the connection to the warehouse. A stopped warehouse fails
+// with ErrWarehouseStopped, unless it's allowed to be started automatically,
+// in which case a warning about the start's cost and latency is logged.
+func (c *sqlClient) ping(ctx context.Context) error {
+	queryCtx, cancel := c.withQueryTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+	if err := timeoutError(ctx, queryCtx, c.db.PingContext(queryCtx)); err != nil {
+		if !c.config.AllowWarehouseAutostart && isWarehouseUnavailable(err) {
+			return fmt.Errorf("%w, starting it automatically is disabled: %w", ErrWarehouseStopped, err)
+		}
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	if elapsed := time.Since(start); c.config.AllowWarehouseAutostart && elapsed > coldStartThreshold {
+		sdk.Logger(ctx).Warn().
+			Dur("elapsed", elapsed).
+			Msg("the warehouse took long to respond and was probably started by the connector, " +
+				"running warehouses incur costs; set allowWarehouseAutostart to false to prevent this")
+	}
+
+	return nil
+}